@@ -1,110 +1,326 @@
 package captcha
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	// TwoCaptchaBaseURL is the default endpoint of TwoCaptchaSolver.
+	TwoCaptchaBaseURL = "https://2captcha.com"
+	// DefaultInitialDelay is the wait between submitting a job to 2captcha and
+	// the first poll; no token is ready sooner.
+	DefaultInitialDelay = 5 * time.Second
+)
+
+// errNotReady is the 2captcha reply to polls for jobs still being solved.
+var errNotReady = errors.New("CAPCHA_NOT_READY")
+
 // TwoCaptchaSolver implements the Solver interface for 2captcha.com.
 type TwoCaptchaSolver struct {
 	APIKey string
-	Client *http.Client
+	// BaseURL is the API endpoint; change it to use a compatible service.
+	BaseURL string
+	Client  *http.Client
+	// InitialDelay is the wait before the first poll. Zero means
+	// DefaultInitialDelay.
+	InitialDelay time.Duration
+	// PollInterval is the wait between polls, and the base of the backoff
+	// between retries of temporary errors. Zero means DefaultPollInterval.
+	PollInterval time.Duration
+	// Timeout bounds a solve whose task context has no deadline. Zero means
+	// DefaultSolveTimeout.
+	Timeout time.Duration
 }
 
 type twoCaptchaRequest struct {
-	Status  int    `json:"status"`
-	Request string `json:"request"`
+	Status    int    `json:"status"`
+	Request   string `json:"request"`
+	ErrorText string `json:"error_text"`
 }
 
 // NewTwoCaptchaSolver creates a new 2captcha solver.
 func NewTwoCaptchaSolver(apiKey string) *TwoCaptchaSolver {
 	return &TwoCaptchaSolver{
-		APIKey: apiKey,
-		Client: &http.Client{Timeout: 30 * time.Second},
+		APIKey:       apiKey,
+		BaseURL:      TwoCaptchaBaseURL,
+		Client:       &http.Client{Timeout: 30 * time.Second},
+		InitialDelay: DefaultInitialDelay,
+		PollInterval: DefaultPollInterval,
+		Timeout:      DefaultSolveTimeout,
 	}
 }
 
 // Solve sends a captcha to 2captcha and polls for the result.
 func (s *TwoCaptchaSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return s.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also forwards the widget parameters.
+func (s *TwoCaptchaSolver) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(s, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask submits task to 2captcha, including the proxy, user agent and
+// cookies of the scraper, and polls for the result until the task's context
+// is done or Timeout passes. Errors reported by 2captcha are returned as
+// *ProviderError; a lack of balance or of workers is retried with backoff.
+func (s *TwoCaptchaSolver) SolveTask(task *Task) (*Result, error) {
+	start := time.Now()
+	ctx := task.Context()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, orDefault(s.Timeout, DefaultSolveTimeout))
+		defer cancel()
+	}
+
 	// Map cloudscraper types to 2captcha method names
 	method := ""
-	switch captchaType {
-	case "reCaptcha":
+	switch task.Type {
+	case ReCaptcha:
 		method = "userrecaptcha"
-	case "hCaptcha":
+	case HCaptcha:
 		method = "hcaptcha"
-	case "turnstile":
+	case Turnstile:
 		method = "turnstile"
 	default:
-		return "", fmt.Errorf("2captcha: unsupported captcha type %s", captchaType)
+		return nil, fmt.Errorf("2captcha: unsupported captcha type %s", task.Type)
 	}
 
 	// 1. Submit the captcha solving job
 	form := url.Values{}
-	form.Add("key", s.APIKey)
 	form.Add("method", method)
-	form.Add("googlekey", siteKey) // sitekey for hcaptcha/turnstile also uses this param
-	form.Add("pageurl", pageURL)
-	form.Add("json", "1")
+	form.Add("googlekey", task.SiteKey) // sitekey for hcaptcha/turnstile also uses this param
+	form.Add("pageurl", task.PageURL)
+	addTwoCaptchaParams(form, task.Type, task.Params)
+	addTwoCaptchaContext(form, task)
 
-	resp, err := s.Client.PostForm("https://2captcha.com/in.php", form)
+	jobID, err := s.submit(ctx, form)
 	if err != nil {
-		return "", fmt.Errorf("2captcha: failed to submit job: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	var req twoCaptchaRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		return "", fmt.Errorf("2captcha: failed to parse submission response: %s", string(body))
+	// 2. Poll for the result
+	token, err := s.pollForResult(ctx, jobID)
+	if err != nil {
+		return nil, err
 	}
+	return &Result{
+		Token:     token,
+		SolverID:  "2captcha",
+		TaskID:    jobID,
+		SolveTime: time.Since(start),
+		UserAgent: task.UserAgent,
+		Reporter:  s,
+	}, nil
+}
+
+// ReportBad tells 2captcha that the token of result was rejected, so that the
+// solve is refunded.
+func (s *TwoCaptchaSolver) ReportBad(result *Result) error {
+	return s.report("reportbad", result)
+}
 
-	if req.Status != 1 {
-		return "", fmt.Errorf("2captcha: submission failed: %s", req.Request)
+// ReportGood tells 2captcha that the token of result was accepted.
+func (s *TwoCaptchaSolver) ReportGood(result *Result) error {
+	return s.report("reportgood", result)
+}
+
+func (s *TwoCaptchaSolver) report(action string, result *Result) error {
+	params := url.Values{"action": {action}, "id": {result.TaskID}}
+	_, err := s.call(context.Background(), "res.php", params)
+	return err
+}
+
+// Balance returns the balance of the 2captcha account, in USD.
+func (s *TwoCaptchaSolver) Balance(ctx context.Context) (float64, error) {
+	balance, err := s.call(ctx, "res.php", url.Values{"action": {"getbalance"}})
+	if err != nil {
+		return 0, err
 	}
+	value, err := strconv.ParseFloat(balance, 64)
+	if err != nil {
+		return 0, fmt.Errorf("2captcha: invalid balance %q", balance)
+	}
+	return value, nil
+}
 
-	jobID := req.Request
+// addTwoCaptchaParams adds the optional widget parameters 2captcha understands
+// for the given captcha type.
+func addTwoCaptchaParams(form url.Values, captchaType string, params Params) {
+	set := func(key, value string) {
+		if value != "" {
+			form.Set(key, value)
+		}
+	}
+	switch captchaType {
+	case Turnstile:
+		set("action", params.Action)
+		set("data", params.CData)
+		set("pagedata", params.PageData)
+	case ReCaptcha:
+		set("action", params.Action)
+		if params.Invisible {
+			form.Set("invisible", "1")
+		}
+		if params.Enterprise {
+			form.Set("enterprise", "1")
+		}
+	case HCaptcha:
+		set("data", params.RQData)
+		if params.Invisible {
+			form.Set("invisible", "1")
+		}
+	}
+}
 
-	// 2. Poll for the result
-	return s.pollForResult(jobID)
+// addTwoCaptchaContext adds the browser context of task: the proxy to solve
+// through, the user agent and, for reCAPTCHA, the cookies.
+func addTwoCaptchaContext(form url.Values, task *Task) {
+	if task.Proxy != nil {
+		proxy := task.Proxy.Host
+		if u := task.Proxy.User; u != nil {
+			proxy = u.String() + "@" + proxy
+		}
+		form.Set("proxy", proxy)
+		form.Set("proxytype", strings.ToUpper(task.Proxy.Scheme))
+	}
+	if task.UserAgent != "" {
+		form.Set("userAgent", task.UserAgent)
+	}
+	if task.Type == ReCaptcha && len(task.Cookies) > 0 {
+		pairs := make([]string, len(task.Cookies))
+		for i, c := range task.Cookies {
+			pairs[i] = c.Name + ":" + c.Value
+		}
+		form.Set("cookies", strings.Join(pairs, ";"))
+	}
+	for key, value := range task.Extra {
+		form.Set(key, value)
+	}
 }
 
-func (s *TwoCaptchaSolver) pollForResult(jobID string) (string, error) {
-	u, _ := url.Parse("https://2captcha.com/res.php")
-	q := u.Query()
-	q.Set("key", s.APIKey)
-	q.Set("action", "get")
-	q.Set("id", jobID)
-	q.Set("json", "1")
-	u.RawQuery = q.Encode()
+// endpoint returns the URL of an API path, defaulting to the 2captcha.com API
+// when BaseURL is not set.
+func (s *TwoCaptchaSolver) endpoint(path string) string {
+	base := s.BaseURL
+	if base == "" {
+		base = TwoCaptchaBaseURL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + path
+}
 
-	// Poll for 180 seconds with 5-second intervals
-	for i := 0; i < 36; i++ {
-		time.Sleep(5 * time.Second)
+// call sends an API request, a POST for in.php and a GET otherwise, and
+// returns the request field of the reply. Error replies are returned as
+// *ProviderError, except CAPCHA_NOT_READY which is returned as errNotReady.
+func (s *TwoCaptchaSolver) call(ctx context.Context, path string, params url.Values) (string, error) {
+	params.Set("key", s.APIKey)
+	params.Set("json", "1")
 
-		resp, err := s.Client.Get(u.String())
-		if err != nil {
-			continue // Retry on network error
+	var req *http.Request
+	var err error
+	if path == "in.php" {
+		req, err = http.NewRequestWithContext(ctx, "POST", s.endpoint(path), strings.NewReader(params.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		}
-		defer resp.Body.Close()
-		
-		body, _ := io.ReadAll(resp.Body)
-		var res twoCaptchaRequest
-		if err := json.Unmarshal(body, &res); err != nil {
-			continue // Retry on parsing error
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "GET", s.endpoint(path)+"?"+params.Encode(), nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("2captcha: failed to build %s request: %w", path, err)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("2captcha: %s request failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("2captcha: failed to read %s response: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("2captcha: %s returned HTTP %d", path, resp.StatusCode)
+	}
+	var res twoCaptchaRequest
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("2captcha: failed to parse %s response: %s", path, string(body))
+	}
+	if res.Status != 1 {
+		if res.Request == errNotReady.Error() {
+			return "", errNotReady
+		}
+		return "", newProviderError("2captcha", res.Request, res.ErrorText)
+	}
+	return res.Request, nil
+}
+
+// submit creates the job described by form and returns its ID. Temporary
+// errors are retried with backoff until ctx is done, in which case the last
+// of them is returned.
+func (s *TwoCaptchaSolver) submit(ctx context.Context, form url.Values) (string, error) {
+	interval := orDefault(s.PollInterval, DefaultPollInterval)
+	for retry := 0; ; retry++ {
+		jobID, err := s.call(ctx, "in.php", form)
+		if err == nil || !isTemporary(err) {
+			return jobID, err
 		}
-		
-		if res.Status == 1 {
-			return res.Request, nil // Success
+		if sleep(ctx, backoff(interval, retry)) != nil {
+			return "", err
 		}
-		if res.Request != "CAPCHA_NOT_READY" {
-			return "", fmt.Errorf("2captcha: polling failed: %s", res.Request)
+	}
+}
+
+// pollForResult waits for the token of jobID. Network failures and temporary
+// errors are retried with backoff; other provider errors end the solve.
+func (s *TwoCaptchaSolver) pollForResult(ctx context.Context, jobID string) (string, error) {
+	interval := orDefault(s.PollInterval, DefaultPollInterval)
+	wait := orDefault(s.InitialDelay, DefaultInitialDelay)
+	var lastErr error
+	for retry := 0; ; {
+		if err := sleep(ctx, wait); err != nil {
+			if lastErr != nil {
+				return "", fmt.Errorf("2captcha: timeout waiting for solve: %w (last error: %v)", err, lastErr)
+			}
+			return "", fmt.Errorf("2captcha: timeout waiting for solve: %w", err)
+		}
+
+		token, err := s.call(ctx, "res.php", url.Values{"action": {"get"}, "id": {jobID}})
+		var pe *ProviderError
+		switch {
+		case err == nil:
+			return token, nil
+		case errors.Is(err, errNotReady):
+			wait, retry = interval, 0
+		case errors.As(err, &pe) && !pe.Temporary():
+			return "", err
+		default:
+			// A network failure, a server error or a temporary provider error.
+			lastErr = err
+			wait = backoff(interval, retry)
+			retry++
 		}
 	}
+}
 
-	return "", fmt.Errorf("2captcha: timeout waiting for solve")
-}
\ No newline at end of file
+// orDefault returns d, or def if d is not positive.
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
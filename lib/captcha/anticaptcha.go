@@ -0,0 +1,167 @@
+package captcha
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AntiCaptchaSolver implements the Solver interface for anti-captcha.com.
+type AntiCaptchaSolver struct {
+	APIKey string
+	// BaseURL is the API endpoint; change it to use a compatible service.
+	BaseURL      string
+	Client       *http.Client
+	PollInterval time.Duration
+}
+
+// NewAntiCaptchaSolver creates a new Anti-Captcha solver.
+func NewAntiCaptchaSolver(apiKey string) *AntiCaptchaSolver {
+	return &AntiCaptchaSolver{
+		APIKey:       apiKey,
+		BaseURL:      AntiCaptchaBaseURL,
+		Client:       &http.Client{Timeout: 30 * time.Second},
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Solve sends a captcha to Anti-Captcha and polls for the result.
+func (s *AntiCaptchaSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return s.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also forwards the widget parameters.
+func (s *AntiCaptchaSolver) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(s, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask solves task with Anti-Captcha, through the task's proxy if it has one.
+func (s *AntiCaptchaSolver) SolveTask(task *Task) (*Result, error) {
+	payload, err := antiCaptchaTask(task)
+	if err != nil {
+		return nil, fmt.Errorf("anti-captcha: %w", err)
+	}
+	return s.api().solve(task, payload)
+}
+
+// Balance returns the balance of the account.
+func (s *AntiCaptchaSolver) Balance(ctx context.Context) (float64, error) {
+	return s.api().balance(ctx)
+}
+
+func (s *AntiCaptchaSolver) api() *taskAPI {
+	return newTaskAPI("anti-captcha", s.BaseURL, AntiCaptchaBaseURL, s.APIKey, s.Client, s.PollInterval)
+}
+
+// CapMonsterSolver implements the Solver interface for CapMonster Cloud, whose
+// API is compatible with Anti-Captcha's. Point BaseURL at a self-hosted
+// CapMonster to use it instead.
+type CapMonsterSolver struct {
+	APIKey string
+	// BaseURL is the API endpoint; change it to use a self-hosted instance.
+	BaseURL      string
+	Client       *http.Client
+	PollInterval time.Duration
+}
+
+// NewCapMonsterSolver creates a new CapMonster Cloud solver.
+func NewCapMonsterSolver(apiKey string) *CapMonsterSolver {
+	return &CapMonsterSolver{
+		APIKey:       apiKey,
+		BaseURL:      CapMonsterBaseURL,
+		Client:       &http.Client{Timeout: 30 * time.Second},
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Solve sends a captcha to CapMonster and polls for the result.
+func (s *CapMonsterSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return s.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also forwards the widget parameters.
+func (s *CapMonsterSolver) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(s, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask solves task with CapMonster, through the task's proxy if it has one.
+func (s *CapMonsterSolver) SolveTask(task *Task) (*Result, error) {
+	payload, err := antiCaptchaTask(task)
+	if err != nil {
+		return nil, fmt.Errorf("capmonster: %w", err)
+	}
+	return s.api().solve(task, payload)
+}
+
+// Balance returns the balance of the account.
+func (s *CapMonsterSolver) Balance(ctx context.Context) (float64, error) {
+	return s.api().balance(ctx)
+}
+
+func (s *CapMonsterSolver) api() *taskAPI {
+	return newTaskAPI("capmonster", s.BaseURL, CapMonsterBaseURL, s.APIKey, s.Client, s.PollInterval)
+}
+
+// antiCaptchaTask builds the Anti-Captcha task object for task. Proxyless task
+// types are used when the scraper connects directly.
+func antiCaptchaTask(task *Task) (map[string]any, error) {
+	payload := map[string]any{
+		"websiteURL": task.PageURL,
+		"websiteKey": task.SiteKey,
+	}
+	p := task.Params
+
+	var taskType string
+	switch task.Type {
+	case Turnstile:
+		taskType = "TurnstileTask"
+		setIf(payload, "action", p.Action)
+		setIf(payload, "turnstileCData", p.CData)
+	case HCaptcha:
+		taskType = "HCaptchaTask"
+		setIf(payload, "isInvisible", p.Invisible)
+		if p.RQData != "" {
+			payload["enterprisePayload"] = map[string]string{"rqdata": p.RQData}
+		}
+	case ReCaptcha:
+		taskType = "RecaptchaV2Task"
+		if p.Enterprise {
+			taskType = "RecaptchaV2EnterpriseTask"
+		}
+		setIf(payload, "isInvisible", p.Invisible)
+		setIf(payload, "pageAction", p.Action)
+	default:
+		return nil, fmt.Errorf("unsupported captcha type %s", task.Type)
+	}
+
+	setIf(payload, "userAgent", task.UserAgent)
+	if len(task.Cookies) > 0 {
+		payload["cookies"] = cookieHeader(task.Cookies)
+	}
+	if task.Proxy == nil {
+		payload["type"] = taskType + "Proxyless"
+		return payload, nil
+	}
+
+	payload["type"] = taskType
+	proxyType := task.Proxy.Scheme
+	if proxyType == "https" {
+		proxyType = "http"
+	}
+	payload["proxyType"] = proxyType
+	payload["proxyAddress"] = task.Proxy.Hostname()
+	port, err := strconv.Atoi(task.Proxy.Port())
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s has no port", task.Proxy.Redacted())
+	}
+	payload["proxyPort"] = port
+	if u := task.Proxy.User; u != nil {
+		payload["proxyLogin"] = u.Username()
+		if password, ok := u.Password(); ok {
+			payload["proxyPassword"] = password
+		}
+	}
+	return payload, nil
+}
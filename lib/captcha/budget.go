@@ -0,0 +1,233 @@
+package captcha
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/errors"
+)
+
+// BudgetOptions limits what a BudgetSolver may spend.
+type BudgetOptions struct {
+	// MaxPerHostPerHour is the number of solves allowed for any one host over
+	// the last hour. Zero means no limit.
+	MaxPerHostPerHour int
+	// MaxSpend is the total amount the solver may spend, in the currency of the
+	// provider's costs (USD for the built-in providers). Zero means no limit.
+	MaxSpend float64
+	// Prices is the cost of one solve per captcha type, used when the provider
+	// does not report the cost of a solve. With a MaxSpend, every type the
+	// provider does not report costs for needs a price.
+	Prices map[string]float64
+}
+
+// ErrUnpriced is returned by a BudgetSolver with a MaxSpend for captcha types
+// that have no price in BudgetOptions.Prices and whose cost the provider does
+// not report, since their spend cannot be accounted for. It wraps
+// errors.ErrCaptchaBudget.
+var ErrUnpriced = fmt.Errorf("%w: no price configured and none reported by the provider", errors.ErrCaptchaBudget)
+
+// BudgetUsage counts solves and their cost.
+type BudgetUsage struct {
+	// Solves is the number of tokens obtained.
+	Solves int
+	// Failures is the number of solves the provider failed.
+	Failures int
+	// Denied is the number of solves refused by the budget.
+	Denied int
+	// Spent is the cost of the tokens obtained.
+	Spent float64
+}
+
+// BudgetStats is a snapshot of a BudgetSolver's counters.
+type BudgetStats struct {
+	BudgetUsage
+	ByHost map[string]BudgetUsage
+	ByType map[string]BudgetUsage
+}
+
+// BudgetSolver enforces BudgetOptions around a solver. Solves that would exceed
+// the budget fail with an *errors.BudgetError, without reaching the provider.
+type BudgetSolver struct {
+	opts  BudgetOptions
+	inner TaskSolver
+	now   func() time.Time
+
+	mu       sync.Mutex
+	recent   map[string][]time.Time // solve attempts in the last hour, per host
+	pending  float64                // expected cost of solves in flight
+	costs    map[string]float64     // last cost reported per captcha type
+	unpriced map[string]bool        // types solved without a price or a reported cost
+	probing  map[string]bool        // unpriced types whose first solve is in flight
+	stats    BudgetStats
+}
+
+// NewBudgetSolver wraps s with the budget described by opts.
+func NewBudgetSolver(s Solver, opts BudgetOptions) *BudgetSolver {
+	return &BudgetSolver{
+		opts:     opts,
+		inner:    AsTaskSolver(s),
+		now:      time.Now,
+		recent:   make(map[string][]time.Time),
+		costs:    make(map[string]float64),
+		unpriced: make(map[string]bool),
+		probing:  make(map[string]bool),
+		stats: BudgetStats{
+			ByHost: make(map[string]BudgetUsage),
+			ByType: make(map[string]BudgetUsage),
+		},
+	}
+}
+
+// Solve solves a captcha within the budget.
+func (b *BudgetSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return b.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also forwards the widget parameters.
+func (b *BudgetSolver) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(b, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask solves task if the budget allows it, and accounts for its cost.
+// The expected cost of a solve is the configured price of its type or, failing
+// that, the cost last reported by the provider for the type. With a MaxSpend,
+// the first solve of a type without a price tells whether the provider reports
+// its cost; other solves of the type are refused while it is in flight, and if
+// the provider reports no cost, later solves of the type fail with ErrUnpriced.
+func (b *BudgetSolver) SolveTask(task *Task) (*Result, error) {
+	host := taskHost(task)
+	price, probe, err := b.reserve(host, task.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.inner.SolveTask(task)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending -= price
+	if probe {
+		delete(b.probing, task.Type)
+	}
+	if err != nil {
+		b.count(host, task.Type, func(u *BudgetUsage) { u.Failures++ })
+		return nil, err
+	}
+	cost := res.Cost
+	if cost > 0 {
+		b.costs[task.Type] = cost
+	} else {
+		cost = price
+		if _, ok := b.opts.Prices[task.Type]; !ok {
+			b.unpriced[task.Type] = true
+		}
+	}
+	b.count(host, task.Type, func(u *BudgetUsage) {
+		u.Solves++
+		u.Spent += cost
+	})
+	return res, nil
+}
+
+// reserve checks the budget for a solve on host and, if it is allowed,
+// records the attempt and returns its expected price. probe is set for the
+// solve that finds out whether the provider reports the cost of the type.
+func (b *BudgetSolver) reserve(host, captchaType string) (price float64, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+
+	price, ok := b.opts.Prices[captchaType]
+	if !ok {
+		price, ok = b.costs[captchaType]
+	}
+	if b.opts.MaxSpend > 0 && !ok {
+		switch {
+		case b.unpriced[captchaType]:
+			err = fmt.Errorf("%w: %s", ErrUnpriced, captchaType)
+		case b.probing[captchaType]:
+			err = fmt.Errorf("%w: the cost of %s captchas is not known yet", errors.ErrCaptchaBudget, captchaType)
+		}
+		if err != nil {
+			b.count(host, captchaType, func(u *BudgetUsage) { u.Denied++ })
+			return 0, false, err
+		}
+		probe = true
+	}
+
+	if max := b.opts.MaxPerHostPerHour; max > 0 {
+		recent := b.recent[host]
+		for len(recent) > 0 && now.Sub(recent[0]) >= time.Hour {
+			recent = recent[1:]
+		}
+		b.recent[host] = recent
+		if len(recent) >= max {
+			b.count(host, captchaType, func(u *BudgetUsage) { u.Denied++ })
+			return 0, false, &errors.BudgetError{
+				Limit:      errors.BudgetHostRate,
+				Host:       host,
+				Used:       float64(len(recent)),
+				Max:        float64(max),
+				RetryAfter: recent[0].Add(time.Hour).Sub(now),
+			}
+		}
+	}
+
+	if max := b.opts.MaxSpend; max > 0 {
+		committed := b.stats.Spent + b.pending
+		if committed >= max || committed+price > max {
+			b.count(host, captchaType, func(u *BudgetUsage) { u.Denied++ })
+			return 0, false, &errors.BudgetError{Limit: errors.BudgetSpend, Host: host, Used: b.stats.Spent, Max: max}
+		}
+	}
+
+	if b.opts.MaxPerHostPerHour > 0 {
+		b.recent[host] = append(b.recent[host], now)
+	}
+	b.pending += price
+	if probe {
+		b.probing[captchaType] = true
+	}
+	return price, probe, nil
+}
+
+// count applies update to the totals and to the host's and type's usage.
+// Callers must hold mu.
+func (b *BudgetSolver) count(host, captchaType string, update func(*BudgetUsage)) {
+	update(&b.stats.BudgetUsage)
+	u := b.stats.ByHost[host]
+	update(&u)
+	b.stats.ByHost[host] = u
+	u = b.stats.ByType[captchaType]
+	update(&u)
+	b.stats.ByType[captchaType] = u
+}
+
+// Stats returns a snapshot of the solver's counters.
+func (b *BudgetSolver) Stats() BudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := BudgetStats{
+		BudgetUsage: b.stats.BudgetUsage,
+		ByHost:      make(map[string]BudgetUsage, len(b.stats.ByHost)),
+		ByType:      make(map[string]BudgetUsage, len(b.stats.ByType)),
+	}
+	for k, v := range b.stats.ByHost {
+		stats.ByHost[k] = v
+	}
+	for k, v := range b.stats.ByType {
+		stats.ByType[k] = v
+	}
+	return stats
+}
+
+func taskHost(task *Task) string {
+	u, err := url.Parse(task.PageURL)
+	if err != nil {
+		return task.PageURL
+	}
+	return u.Hostname()
+}
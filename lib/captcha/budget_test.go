@@ -0,0 +1,168 @@
+package captcha
+
+import (
+	stderrors "errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/errors"
+)
+
+func TestBudgetSolver_HostRate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := NewBudgetSolver(&fakeSolver{token: "tok"}, BudgetOptions{MaxPerHostPerHour: 2})
+	b.now = func() time.Time { return now }
+
+	solve := func(pageURL string) error {
+		_, err := b.SolveTask(&Task{Type: Turnstile, PageURL: pageURL})
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := solve("https://a.example/page"); err != nil {
+			t.Fatalf("solve %d: %v", i, err)
+		}
+		now = now.Add(10 * time.Minute)
+	}
+
+	var be *errors.BudgetError
+	if err := solve("https://a.example/other"); !stderrors.As(err, &be) || !stderrors.Is(err, errors.ErrCaptchaBudget) {
+		t.Fatalf("error = %v, want a BudgetError", err)
+	}
+	if be.Limit != errors.BudgetHostRate || be.Host != "a.example" || be.RetryAfter != 40*time.Minute {
+		t.Errorf("BudgetError = %+v", be)
+	}
+	if err := solve("https://b.example/"); err != nil {
+		t.Errorf("another host should not be limited: %v", err)
+	}
+
+	now = now.Add(41 * time.Minute)
+	if err := solve("https://a.example/"); err != nil {
+		t.Errorf("the oldest solve left the window: %v", err)
+	}
+
+	stats := b.Stats()
+	if a := stats.ByHost["a.example"]; a.Solves != 3 || a.Denied != 1 {
+		t.Errorf("a.example usage = %+v", a)
+	}
+	if stats.Solves != 4 || stats.Denied != 1 {
+		t.Errorf("total usage = %+v", stats.BudgetUsage)
+	}
+}
+
+// costSolver reports a fixed cost for every solve.
+type costSolver struct{ cost float64 }
+
+func (s costSolver) SolveTask(task *Task) (*Result, error) {
+	return &Result{Token: "tok", Cost: s.cost}, nil
+}
+
+func (s costSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return solveWithParams(s, captchaType, pageURL, siteKey, Params{})
+}
+
+func TestBudgetSolver_Spend(t *testing.T) {
+	// The provider does not report costs: the configured prices are used.
+	b := NewBudgetSolver(&fakeSolver{token: "tok"}, BudgetOptions{
+		MaxSpend: 0.005,
+		Prices:   map[string]float64{Turnstile: 0.002, ReCaptcha: 0.003},
+	})
+	for _, typ := range []string{Turnstile, Turnstile} {
+		if _, err := b.SolveTask(&Task{Type: typ, PageURL: "https://a.example/"}); err != nil {
+			t.Fatalf("solve %s: %v", typ, err)
+		}
+	}
+	_, err := b.SolveTask(&Task{Type: ReCaptcha, PageURL: "https://a.example/"})
+	var be *errors.BudgetError
+	if !stderrors.As(err, &be) || be.Limit != errors.BudgetSpend {
+		t.Fatalf("error = %v, want a spend BudgetError", err)
+	}
+	stats := b.Stats()
+	if stats.ByType[Turnstile].Spent != 0.004 || stats.ByType[ReCaptcha].Denied != 1 {
+		t.Errorf("usage by type = %+v", stats.ByType)
+	}
+
+	// Reported costs take precedence over the configured prices.
+	b = NewBudgetSolver(costSolver{cost: 0.01}, BudgetOptions{MaxSpend: 0.015, Prices: map[string]float64{Turnstile: 0.001}})
+	if _, err := b.SolveTask(&Task{Type: Turnstile}); err != nil {
+		t.Fatalf("first solve: %v", err)
+	}
+	if _, err := b.SolveTask(&Task{Type: Turnstile}); err != nil {
+		t.Fatalf("second solve: %v", err)
+	}
+	if _, err := b.SolveTask(&Task{Type: Turnstile}); !stderrors.Is(err, errors.ErrCaptchaBudget) {
+		t.Errorf("error = %v, want ErrCaptchaBudget once 0.02 is spent", err)
+	}
+	if got := b.Stats().Spent; got != 0.02 {
+		t.Errorf("spent = %v, want 0.02", got)
+	}
+}
+
+func TestBudgetSolver_Unpriced(t *testing.T) {
+	// The provider reports no cost and Turnstile has no price: the spend of
+	// Turnstile solves cannot be accounted for, so they are refused.
+	inner := &fakeSolver{token: "tok"}
+	b := NewBudgetSolver(inner, BudgetOptions{MaxSpend: 5, Prices: map[string]float64{ReCaptcha: 0.003}})
+	if _, err := b.SolveTask(&Task{Type: Turnstile}); err != nil {
+		t.Fatalf("first solve: %v", err)
+	}
+	_, err := b.SolveTask(&Task{Type: Turnstile})
+	if !stderrors.Is(err, ErrUnpriced) || !stderrors.Is(err, errors.ErrCaptchaBudget) {
+		t.Fatalf("error = %v, want ErrUnpriced", err)
+	}
+	if got := inner.calls.Load(); got != 1 {
+		t.Errorf("provider called %d times, want 1", got)
+	}
+	if _, err := b.SolveTask(&Task{Type: ReCaptcha}); err != nil {
+		t.Errorf("priced type: %v", err)
+	}
+
+	// A provider reporting costs needs no prices; the last reported cost is
+	// the expected cost of the next solve.
+	b = NewBudgetSolver(costSolver{cost: 0.01}, BudgetOptions{MaxSpend: 0.015})
+	if _, err := b.SolveTask(&Task{Type: Turnstile}); err != nil {
+		t.Fatalf("first solve: %v", err)
+	}
+	var be *errors.BudgetError
+	if _, err := b.SolveTask(&Task{Type: Turnstile}); !stderrors.As(err, &be) || be.Limit != errors.BudgetSpend {
+		t.Errorf("error = %v, want a spend BudgetError", err)
+	}
+}
+
+func TestBudgetSolver_UnpricedInFlight(t *testing.T) {
+	// While the first solve of an unpriced type is in flight, its cost is
+	// unknown, so concurrent solves of the type are refused.
+	inner := &fakeSolver{token: "tok", delay: 50 * time.Millisecond}
+	b := NewBudgetSolver(inner, BudgetOptions{MaxSpend: 5})
+
+	const n = 8
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = b.SolveTask(&Task{Type: Turnstile})
+		}()
+	}
+	wg.Wait()
+
+	solved := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			solved++
+		case !stderrors.Is(err, errors.ErrCaptchaBudget):
+			t.Errorf("error = %v, want ErrCaptchaBudget", err)
+		}
+	}
+	if solved != 1 {
+		t.Errorf("%d solves succeeded, want 1", solved)
+	}
+	if got := inner.calls.Load(); got != 1 {
+		t.Errorf("provider called %d times, want 1", got)
+	}
+	if u := b.Stats().BudgetUsage; u.Denied != n-1 {
+		t.Errorf("Usage = %+v, want %d denied", u, n-1)
+	}
+}
@@ -0,0 +1,255 @@
+package captcha
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultTokenTTL is how long a token is reused for captcha types without an
+// entry in TokenCache.TTL. Turnstile tokens are valid for 300 seconds and
+// reCAPTCHA and hCaptcha tokens for 120; the defaults leave a margin for the
+// submission.
+var DefaultTokenTTL = map[string]time.Duration{
+	Turnstile: 270 * time.Second,
+	ReCaptcha: 100 * time.Second,
+	HCaptcha:  100 * time.Second,
+}
+
+// Releaser is implemented by the Reporter of results whose token can be
+// handed back when it was not submitted, see Release.
+type Releaser interface {
+	Release(result *Result)
+}
+
+// Release hands back the token of a result that was not submitted, so that
+// the solver that produced it can reuse it. It does nothing for solvers that
+// cannot.
+func Release(result *Result) {
+	if r, ok := result.Reporter.(Releaser); ok {
+		r.Release(result)
+	}
+}
+
+// TokenCacheStats counts what a TokenCache did.
+type TokenCacheStats struct {
+	// Hits is the number of solves answered with a cached token.
+	Hits int
+	// Misses is the number of solves passed to the wrapped solver.
+	Misses int
+	// Stored is the number of tokens cached: released, or solved after the
+	// caller gave up.
+	Stored int
+	// Rejected is the number of tokens reported bad.
+	Rejected int
+}
+
+// TokenCache saves paid solves by reusing tokens that were obtained but never
+// submitted: tokens released with Release, and tokens the wrapped solver
+// returns after the caller stopped waiting. Such a token is reused once, for
+// the same site key, host and proxy, while it is still valid. Tokens reported
+// bad are never reused.
+//
+// Wrap a BudgetSolver with the cache, not the other way around, so that reused
+// tokens are not charged to the budget.
+type TokenCache struct {
+	// TTL overrides DefaultTokenTTL per captcha type.
+	TTL map[string]time.Duration
+
+	inner TaskSolver
+	now   func() time.Time
+
+	mu       sync.Mutex
+	tokens   map[string][]cachedToken
+	rejected map[string]time.Time // token -> when it would have expired
+	stats    TokenCacheStats
+}
+
+type cachedToken struct {
+	result  Result
+	expires time.Time
+}
+
+// NewTokenCache wraps s with a token cache.
+func NewTokenCache(s Solver) *TokenCache {
+	return &TokenCache{
+		inner:    AsTaskSolver(s),
+		now:      time.Now,
+		tokens:   make(map[string][]cachedToken),
+		rejected: make(map[string]time.Time),
+	}
+}
+
+// Solve returns a cached token for the captcha, or solves it.
+func (c *TokenCache) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return c.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also forwards the widget parameters.
+func (c *TokenCache) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(c, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask returns a cached token for task, or solves it with the wrapped
+// solver. If the task's context ends first, the solve goes on in the
+// background and its token is cached.
+func (c *TokenCache) SolveTask(task *Task) (*Result, error) {
+	key := tokenCacheKey(task)
+	if res, ok := c.take(key); ok {
+		return res, nil
+	}
+
+	type outcome struct {
+		res *Result
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := c.inner.SolveTask(task.WithContext(context.WithoutCancel(task.Context())))
+		done <- outcome{res, err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return nil, o.err
+		}
+		return c.ticket(key, task.Type, o.res), nil
+	case <-task.Context().Done():
+		go func() {
+			if o := <-done; o.err == nil {
+				Release(c.ticket(key, task.Type, o.res))
+			}
+		}()
+		return nil, task.Context().Err()
+	}
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *TokenCache) Stats() TokenCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// take removes and returns an unexpired token for key.
+func (c *TokenCache) take(key string) (*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	tokens := c.tokens[key]
+	for len(tokens) > 0 {
+		t := tokens[0]
+		tokens = tokens[1:]
+		if _, bad := c.rejected[t.result.Token]; !bad && now.Before(t.expires) {
+			c.setTokens(key, tokens)
+			c.stats.Hits++
+			res := t.result
+			res.Reporter = &cacheTicket{cache: c, key: key, expires: t.expires, inner: res.Reporter}
+			return &res, true
+		}
+	}
+	c.setTokens(key, nil)
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *TokenCache) setTokens(key string, tokens []cachedToken) {
+	if len(tokens) == 0 {
+		delete(c.tokens, key)
+		return
+	}
+	c.tokens[key] = tokens
+}
+
+// ticket wraps the Reporter of a freshly solved result so that releases and
+// reports go through the cache.
+func (c *TokenCache) ticket(key, captchaType string, res *Result) *Result {
+	ttl, ok := c.TTL[captchaType]
+	if !ok {
+		ttl, ok = DefaultTokenTTL[captchaType]
+	}
+	if !ok {
+		ttl = DefaultTokenTTL[ReCaptcha]
+	}
+	out := *res
+	out.Reporter = &cacheTicket{cache: c, key: key, expires: c.now().Add(ttl), inner: res.Reporter}
+	return &out
+}
+
+// store caches result under key until expires, unless it was rejected.
+func (c *TokenCache) store(key string, result Result, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if _, bad := c.rejected[result.Token]; bad || !now.Before(expires) {
+		return
+	}
+	c.tokens[key] = append(c.tokens[key], cachedToken{result: result, expires: expires})
+	c.stats.Stored++
+}
+
+// reject records a token the site refused. It is remembered until it would
+// have expired anyway.
+func (c *TokenCache) reject(token string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for t, exp := range c.rejected {
+		if !now.Before(exp) {
+			delete(c.rejected, t)
+		}
+	}
+	c.rejected[token] = expires
+	c.stats.Rejected++
+}
+
+// cacheTicket is the Reporter of results that went through a TokenCache.
+type cacheTicket struct {
+	cache   *TokenCache
+	key     string
+	expires time.Time
+	inner   Reporter
+}
+
+func (t *cacheTicket) Release(result *Result) {
+	stored := *result
+	stored.Reporter = t.inner
+	t.cache.store(t.key, stored, t.expires)
+}
+
+func (t *cacheTicket) ReportBad(result *Result) error {
+	t.cache.reject(result.Token, t.expires)
+	if t.inner == nil {
+		return nil
+	}
+	return t.inner.ReportBad(result)
+}
+
+func (t *cacheTicket) ReportGood(result *Result) error {
+	if t.inner == nil {
+		return nil
+	}
+	return t.inner.ReportGood(result)
+}
+
+// tokenCacheKey identifies where a token can be used: the widget with its
+// action, cData and page data, the host it was solved for, and the proxy it
+// was solved through. Turnstile binds tokens to the action and cData, so a
+// token solved for other values fails verification.
+func tokenCacheKey(task *Task) string {
+	host := task.PageURL
+	if u, err := url.Parse(task.PageURL); err == nil {
+		host = u.Host
+	}
+	proxy := ""
+	if p := task.Proxy; p != nil {
+		proxy = p.Scheme + "://" + p.Host
+		if p.User != nil {
+			proxy = p.Scheme + "://" + p.User.Username() + "@" + p.Host
+		}
+	}
+	p := task.Params
+	return task.Type + "|" + task.SiteKey + "|" + host + "|" + proxy + "|" + p.Action + "|" + p.CData + "|" + p.PageData
+}
@@ -0,0 +1,116 @@
+package captcha
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CapSolver implements the Solver interface for capsolver.com. CapSolver does
+// not solve hCaptcha.
+type CapSolver struct {
+	APIKey string
+	// BaseURL is the API endpoint; change it to use a compatible service.
+	BaseURL      string
+	Client       *http.Client
+	PollInterval time.Duration
+}
+
+// NewCapSolver creates a new CapSolver solver.
+func NewCapSolver(apiKey string) *CapSolver {
+	return &CapSolver{
+		APIKey:       apiKey,
+		BaseURL:      CapSolverBaseURL,
+		Client:       &http.Client{Timeout: 30 * time.Second},
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Solve sends a captcha to CapSolver and polls for the result.
+func (s *CapSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return s.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also forwards the widget parameters.
+func (s *CapSolver) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(s, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask solves task with CapSolver. reCAPTCHA is solved through the task's
+// proxy if it has one; Turnstile is always solved without a proxy.
+func (s *CapSolver) SolveTask(task *Task) (*Result, error) {
+	payload, err := capSolverTask(task)
+	if err != nil {
+		return nil, fmt.Errorf("capsolver: %w", err)
+	}
+	return s.api().solve(task, payload)
+}
+
+// Balance returns the balance of the account.
+func (s *CapSolver) Balance(ctx context.Context) (float64, error) {
+	return s.api().balance(ctx)
+}
+
+func (s *CapSolver) api() *taskAPI {
+	return newTaskAPI("capsolver", s.BaseURL, CapSolverBaseURL, s.APIKey, s.Client, s.PollInterval)
+}
+
+// capSolverTask builds the CapSolver task object for task.
+func capSolverTask(task *Task) (map[string]any, error) {
+	payload := map[string]any{
+		"websiteURL": task.PageURL,
+		"websiteKey": task.SiteKey,
+	}
+	p := task.Params
+
+	switch task.Type {
+	case Turnstile:
+		payload["type"] = "AntiTurnstileTaskProxyLess"
+		metadata := map[string]string{}
+		if p.Action != "" {
+			metadata["action"] = p.Action
+		}
+		if p.CData != "" {
+			metadata["cdata"] = p.CData
+		}
+		if len(metadata) > 0 {
+			payload["metadata"] = metadata
+		}
+		return payload, nil
+	case ReCaptcha:
+		taskType := "ReCaptchaV2Task"
+		if p.Enterprise {
+			taskType = "ReCaptchaV2EnterpriseTask"
+		}
+		setIf(payload, "isInvisible", p.Invisible)
+		setIf(payload, "pageAction", p.Action)
+		setIf(payload, "userAgent", task.UserAgent)
+		if len(task.Cookies) > 0 {
+			cookies := make([]map[string]string, len(task.Cookies))
+			for i, c := range task.Cookies {
+				cookies[i] = map[string]string{"name": c.Name, "value": c.Value}
+			}
+			payload["cookies"] = cookies
+		}
+		if task.Proxy == nil {
+			payload["type"] = taskType + "ProxyLess"
+			return payload, nil
+		}
+		payload["type"] = taskType
+		payload["proxy"] = capSolverProxy(task)
+		return payload, nil
+	}
+	return nil, fmt.Errorf("unsupported captcha type %s", task.Type)
+}
+
+// capSolverProxy formats the task's proxy as scheme:host:port[:user:password].
+func capSolverProxy(task *Task) string {
+	parts := []string{task.Proxy.Scheme, task.Proxy.Hostname(), task.Proxy.Port()}
+	if u := task.Proxy.User; u != nil {
+		password, _ := u.Password()
+		parts = append(parts, u.Username(), password)
+	}
+	return strings.Join(parts, ":")
+}
@@ -1,6 +1,37 @@
 package captcha
 
+// Captcha types passed to Solver.Solve.
+const (
+	Turnstile = "turnstile"
+	HCaptcha  = "hCaptcha"
+	ReCaptcha = "reCaptcha"
+)
+
 // Solver defines the interface for a captcha solving service.
 type Solver interface {
 	Solve(captchaType, url, siteKey string) (string, error)
-}
\ No newline at end of file
+}
+
+// Params holds the optional widget parameters found on a captcha page. Some
+// widgets only accept a token solved with the same parameters.
+type Params struct {
+	// Action is the Turnstile or reCAPTCHA v3 action (data-action).
+	Action string
+	// CData is the Turnstile customer data (data-cdata).
+	CData string
+	// PageData is the Turnstile chlPageData value of Cloudflare challenge pages.
+	PageData string
+	// RQData is the hCaptcha Enterprise rqdata value (data-rqdata).
+	RQData string
+	// Invisible is set for invisible widgets (data-size="invisible").
+	Invisible bool
+	// Enterprise is set for reCAPTCHA and hCaptcha Enterprise widgets.
+	Enterprise bool
+}
+
+// ParamSolver is implemented by solvers that accept the widget parameters in
+// addition to the site key. The scraper uses it when available.
+type ParamSolver interface {
+	Solver
+	SolveWithParams(captchaType, url, siteKey string, params Params) (string, error)
+}
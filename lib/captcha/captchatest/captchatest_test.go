@@ -0,0 +1,87 @@
+package captchatest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/captcha"
+	"github.com/Advik-B/cloudscraper/lib/captcha/captchatest"
+)
+
+func TestSolver_Script(t *testing.T) {
+	s := captchatest.NewSolver(captchatest.Fail(captchatest.ErrScripted), captchatest.Succeed("first"))
+	s.Token = "default"
+
+	var got []string
+	for range 3 {
+		token, err := s.Solve(captcha.Turnstile, "https://example.com/", "0x4AAA")
+		if err != nil {
+			token = err.Error()
+		}
+		got = append(got, token)
+	}
+	want := []string{captchatest.ErrScripted.Error(), "first", "default"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("solve %d = %q, want %q", i+1, got[i], want[i])
+		}
+	}
+	if tasks := s.Tasks(); len(tasks) != 3 || tasks[0].SiteKey != "0x4AAA" {
+		t.Errorf("tasks = %+v", tasks)
+	}
+}
+
+func TestSolver_DelayHonoursContext(t *testing.T) {
+	s := &captchatest.Solver{Delay: time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := s.SolveTask((&captcha.Task{Type: captcha.Turnstile}).WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestTwoCaptchaServer(t *testing.T) {
+	server := captchatest.NewTwoCaptchaServer()
+	defer server.Close()
+	server.Token = "tok"
+	server.SubmitErrors = []string{"ERROR_NO_SLOT_AVAILABLE"}
+	server.PollErrors = []string{"ERROR_ZERO_BALANCE"}
+
+	solver := server.Solver()
+	res, err := solver.SolveTask(&captcha.Task{
+		Type:    captcha.Turnstile,
+		PageURL: "https://example.com/",
+		SiteKey: "0x4AAA",
+		Params:  captcha.Params{Action: "managed"},
+	})
+	if err != nil {
+		t.Fatalf("SolveTask: %v", err)
+	}
+	if res.Token != "tok" || res.TaskID != "1" {
+		t.Errorf("result = %+v", res)
+	}
+	if err := solver.ReportBad(res); err != nil {
+		t.Errorf("ReportBad: %v", err)
+	}
+
+	jobs := server.Jobs()
+	if len(jobs) != 1 {
+		t.Fatalf("jobs = %+v, want one", jobs)
+	}
+	if j := jobs[0]; j.Form.Get("method") != "turnstile" || j.Form.Get("action") != "managed" || j.Polls != 2 || j.Reported != "reportbad" {
+		t.Errorf("job = %+v", j)
+	}
+
+	if balance, err := solver.Balance(context.Background()); err != nil || balance != 10 {
+		t.Errorf("Balance = %v, %v", balance, err)
+	}
+
+	solver.APIKey = "wrong"
+	if _, err := solver.Solve(captcha.Turnstile, "https://example.com/", "0x4AAA"); !errors.Is(err, captcha.ErrInvalidKey) {
+		t.Errorf("error = %v, want captcha.ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,163 @@
+// Package captchatest provides stand-ins for captcha providers, so that
+// captcha flows can be tested without a provider account.
+//
+// Solver is a scripted captcha.TaskSolver. TwoCaptchaServer is a local HTTP
+// server speaking the 2captcha API, for testing captcha.TwoCaptchaSolver or
+// any client of a 2captcha-compatible service.
+package captchatest
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/captcha"
+)
+
+// DefaultToken is the token returned when no other is configured.
+const DefaultToken = "captchatest-token"
+
+// ErrScripted is a ready-made error for failing outcomes.
+var ErrScripted = errors.New("captchatest: scripted failure")
+
+// Outcome is the result of one solve.
+type Outcome struct {
+	// Token is returned when Err is nil. Empty means the solver's Token.
+	Token string
+	// Err fails the solve.
+	Err error
+	// Delay overrides the solver's Delay for this solve.
+	Delay time.Duration
+}
+
+// Succeed returns an outcome returning token.
+func Succeed(token string) Outcome {
+	return Outcome{Token: token}
+}
+
+// Fail returns an outcome failing with err.
+func Fail(err error) Outcome {
+	return Outcome{Err: err}
+}
+
+// Solver is a fake captcha solver. Its solves follow Script in order, then
+// return Token; each one waits for Delay first, or until the task's context
+// is done. It records the tasks it receives and the reports made on its
+// results.
+type Solver struct {
+	// Token is returned once Script is exhausted. Empty means DefaultToken.
+	Token string
+	// Delay is the latency of every solve.
+	Delay time.Duration
+	// Script lists the outcomes of the first solves.
+	Script []Outcome
+	// Cost is set on every result.
+	Cost float64
+
+	mu    sync.Mutex
+	tasks []*captcha.Task
+	good  []*captcha.Result
+	bad   []*captcha.Result
+}
+
+// NewSolver returns a solver whose solves follow script, then return
+// DefaultToken.
+func NewSolver(script ...Outcome) *Solver {
+	return &Solver{Script: script}
+}
+
+// Solve solves the captcha.
+func (s *Solver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return s.SolveWithParams(captchaType, pageURL, siteKey, captcha.Params{})
+}
+
+// SolveWithParams is like Solve but also records the widget parameters.
+func (s *Solver) SolveWithParams(captchaType, pageURL, siteKey string, params captcha.Params) (string, error) {
+	res, err := s.SolveTask(&captcha.Task{Type: captchaType, PageURL: pageURL, SiteKey: siteKey, Params: params})
+	if err != nil {
+		return "", err
+	}
+	return res.Token, nil
+}
+
+// SolveTask records task and returns its scripted outcome.
+func (s *Solver) SolveTask(task *captcha.Task) (*captcha.Result, error) {
+	start := time.Now()
+	s.mu.Lock()
+	s.tasks = append(s.tasks, task)
+	n := len(s.tasks)
+	o := Outcome{Delay: s.Delay}
+	if n <= len(s.Script) {
+		o = s.Script[n-1]
+		if o.Delay == 0 {
+			o.Delay = s.Delay
+		}
+	}
+	if o.Token == "" {
+		o.Token = s.Token
+	}
+	if o.Token == "" {
+		o.Token = DefaultToken
+	}
+	s.mu.Unlock()
+
+	if o.Delay > 0 {
+		t := time.NewTimer(o.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-task.Context().Done():
+			return nil, task.Context().Err()
+		}
+	}
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	return &captcha.Result{
+		Token:     o.Token,
+		Cost:      s.Cost,
+		SolverID:  "captchatest",
+		TaskID:    strconv.Itoa(n),
+		SolveTime: time.Since(start),
+		UserAgent: task.UserAgent,
+		Reporter:  s,
+	}, nil
+}
+
+// ReportBad records that the token of result was rejected.
+func (s *Solver) ReportBad(result *captcha.Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bad = append(s.bad, result)
+	return nil
+}
+
+// ReportGood records that the token of result was accepted.
+func (s *Solver) ReportGood(result *captcha.Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.good = append(s.good, result)
+	return nil
+}
+
+// Calls returns the number of solves so far.
+func (s *Solver) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+// Tasks returns the tasks received so far, in order.
+func (s *Solver) Tasks() []*captcha.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*captcha.Task(nil), s.tasks...)
+}
+
+// Reported returns the results reported good and bad so far.
+func (s *Solver) Reported() (good, bad []*captcha.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*captcha.Result(nil), s.good...), append([]*captcha.Result(nil), s.bad...)
+}
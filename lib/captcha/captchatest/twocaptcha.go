@@ -0,0 +1,184 @@
+package captchatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/captcha"
+)
+
+// DefaultAPIKey is the API key a TwoCaptchaServer accepts by default.
+const DefaultAPIKey = "captchatest-key"
+
+// Job is a captcha submitted to a TwoCaptchaServer.
+type Job struct {
+	ID string
+	// Form holds the in.php parameters, without the key.
+	Form url.Values
+	// Polls is the number of res.php polls for the job.
+	Polls int
+	// Reported is "reportgood" or "reportbad" once the job was reported.
+	Reported string
+}
+
+// TwoCaptchaServer is a local server speaking the 2captcha in.php/res.php
+// API. Error codes listed in SubmitErrors and PollErrors are returned first,
+// one per request; a job is ready once it was polled more than
+// PollsUntilReady times, error replies included.
+type TwoCaptchaServer struct {
+	*httptest.Server
+
+	// APIKey is the accepted key; other keys get ERROR_WRONG_USER_KEY.
+	APIKey string
+	// Token is the solution of every job.
+	Token string
+	// PollsUntilReady is the number of polls before a job is ready.
+	PollsUntilReady int
+	// SubmitErrors are error codes returned by the next in.php requests.
+	SubmitErrors []string
+	// PollErrors are error codes returned by the next res.php polls.
+	PollErrors []string
+	// Balance is returned by getbalance.
+	Balance float64
+
+	mu   sync.Mutex
+	jobs []*Job
+}
+
+// NewTwoCaptchaServer starts a server accepting DefaultAPIKey and solving
+// every job with DefaultToken on the second poll. Close it when done.
+func NewTwoCaptchaServer() *TwoCaptchaServer {
+	s := &TwoCaptchaServer{
+		APIKey:          DefaultAPIKey,
+		Token:           DefaultToken,
+		PollsUntilReady: 1,
+		Balance:         10,
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Solver returns a TwoCaptchaSolver using the server, with delays short
+// enough for tests.
+func (s *TwoCaptchaServer) Solver() *captcha.TwoCaptchaSolver {
+	solver := captcha.NewTwoCaptchaSolver(s.APIKey)
+	solver.BaseURL = s.URL
+	solver.InitialDelay = time.Millisecond
+	solver.PollInterval = time.Millisecond
+	return solver
+}
+
+// Jobs returns a snapshot of the submitted jobs, in order.
+func (s *TwoCaptchaServer) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, len(s.jobs))
+	for i, j := range s.jobs {
+		jobs[i] = *j
+	}
+	return jobs
+}
+
+// ServeHTTP implements http.Handler.
+func (s *TwoCaptchaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Form.Get("key") != s.APIKey {
+		reply(w, 0, "ERROR_WRONG_USER_KEY")
+		return
+	}
+	switch r.URL.Path {
+	case "/in.php":
+		s.submit(w, r.Form)
+	case "/res.php":
+		s.result(w, r.Form)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// submit handles in.php. Callers must hold mu.
+func (s *TwoCaptchaServer) submit(w http.ResponseWriter, form url.Values) {
+	if code, ok := next(&s.SubmitErrors); ok {
+		reply(w, 0, code)
+		return
+	}
+	switch form.Get("method") {
+	case "turnstile", "userrecaptcha", "hcaptcha":
+	default:
+		reply(w, 0, "ERROR_BAD_PARAMETERS")
+		return
+	}
+	if form.Get("googlekey") == "" || form.Get("pageurl") == "" {
+		reply(w, 0, "ERROR_BAD_PARAMETERS")
+		return
+	}
+	params := url.Values{}
+	for k, v := range form {
+		if k != "key" {
+			params[k] = v
+		}
+	}
+	job := &Job{ID: strconv.Itoa(len(s.jobs) + 1), Form: params}
+	s.jobs = append(s.jobs, job)
+	reply(w, 1, job.ID)
+}
+
+// result handles res.php. Callers must hold mu.
+func (s *TwoCaptchaServer) result(w http.ResponseWriter, form url.Values) {
+	action := form.Get("action")
+	if action == "getbalance" {
+		reply(w, 1, strconv.FormatFloat(s.Balance, 'f', -1, 64))
+		return
+	}
+	var job *Job
+	for _, j := range s.jobs {
+		if j.ID == form.Get("id") {
+			job = j
+		}
+	}
+	if job == nil {
+		reply(w, 0, "ERROR_WRONG_CAPTCHA_ID")
+		return
+	}
+	switch action {
+	case "get":
+		job.Polls++
+		if code, ok := next(&s.PollErrors); ok {
+			reply(w, 0, code)
+			return
+		}
+		if job.Polls <= s.PollsUntilReady {
+			reply(w, 0, "CAPCHA_NOT_READY")
+			return
+		}
+		reply(w, 1, s.Token)
+	case "reportgood", "reportbad":
+		job.Reported = action
+		reply(w, 1, "OK_REPORT_RECORDED")
+	default:
+		reply(w, 0, "ERROR_WRONG_ACTION")
+	}
+}
+
+// next pops the first code of codes.
+func next(codes *[]string) (string, bool) {
+	if len(*codes) == 0 {
+		return "", false
+	}
+	code := (*codes)[0]
+	*codes = (*codes)[1:]
+	return code, true
+}
+
+func reply(w http.ResponseWriter, status int, request string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": status, "request": request})
+}
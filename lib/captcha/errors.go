@@ -0,0 +1,96 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Classes of provider errors. A *ProviderError wraps one of them when its code
+// is known; use errors.Is to test for them.
+var (
+	ErrInvalidKey      = errors.New("captcha: invalid API key")
+	ErrZeroBalance     = errors.New("captcha: account balance is empty")
+	ErrNoSlotAvailable = errors.New("captcha: no worker available")
+	ErrUnsolvable      = errors.New("captcha: captcha could not be solved")
+)
+
+// maxBackoff caps the wait between retries of temporary provider errors.
+const maxBackoff = time.Minute
+
+// ProviderError is an error code returned by a captcha provider.
+type ProviderError struct {
+	Provider    string
+	Code        string
+	Description string
+	// Err is the class of the error, one of the errors above, or nil for codes
+	// that are not classified.
+	Err error
+}
+
+func newProviderError(provider, code, description string) *ProviderError {
+	e := &ProviderError{Provider: provider, Code: code, Description: description}
+	switch code {
+	case "ERROR_WRONG_USER_KEY", "ERROR_KEY_DOES_NOT_EXIST":
+		e.Err = ErrInvalidKey
+	case "ERROR_ZERO_BALANCE":
+		e.Err = ErrZeroBalance
+	case "ERROR_NO_SLOT_AVAILABLE", "MAX_USER_TURN":
+		e.Err = ErrNoSlotAvailable
+	case "ERROR_CAPTCHA_UNSOLVABLE":
+		e.Err = ErrUnsolvable
+	}
+	return e
+}
+
+func (e *ProviderError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s: %s", e.Provider, e.Code, e.Description)
+	}
+	return fmt.Sprintf("%s: %s", e.Provider, e.Code)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the same request may succeed later: the account
+// may be topped up, or a worker may become available.
+func (e *ProviderError) Temporary() bool {
+	return e.Err == ErrZeroBalance || e.Err == ErrNoSlotAvailable
+}
+
+// isTemporary reports whether err is a temporary *ProviderError.
+func isTemporary(err error) bool {
+	var pe *ProviderError
+	return errors.As(err, &pe) && pe.Temporary()
+}
+
+// backoff returns the wait before the n-th retry (from 0): base doubled n
+// times, capped at maxBackoff.
+func backoff(base time.Duration, n int) time.Duration {
+	d := base
+	for i := 0; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// sleep waits for d, or returns ctx's error once it is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Balancer is implemented by solvers that can query the provider account's
+// balance, in the currency of the provider's costs.
+type Balancer interface {
+	Balance(ctx context.Context) (float64, error)
+}
@@ -0,0 +1,215 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultManualTimeout is how long a ManualSolver waits for an operator when
+// the task's context has no deadline.
+const DefaultManualTimeout = 10 * time.Minute
+
+// ErrUnknownTask is returned when resolving a task that does not exist, was
+// already resolved or was abandoned.
+var ErrUnknownTask = errors.New("captcha: no pending task with this ID")
+
+// PendingTask is a captcha waiting for an operator to solve it.
+type PendingTask struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	PageURL string    `json:"page_url"`
+	SiteKey string    `json:"site_key"`
+	Params  Params    `json:"params"`
+	Created time.Time `json:"created"`
+
+	token chan string
+}
+
+// ManualSolver hands captchas to a person instead of a paid service. Each task
+// is published on the Notify channel and on the solver's HTTP page, and the
+// solve waits until an operator provides the token through Resolve or the page.
+//
+// A ManualSolver is an http.Handler serving the page:
+//
+//	solver := captcha.NewManualSolver()
+//	go http.ListenAndServe("localhost:8089", solver)
+type ManualSolver struct {
+	// Notify, if set, receives every new task. Sends do not block: when the
+	// channel is full the task is only listed by Pending and on the page.
+	Notify chan<- *PendingTask
+	// Timeout bounds the wait for a token when the task's context has no
+	// deadline. Zero means DefaultManualTimeout.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	seq     int
+	pending map[string]*PendingTask
+}
+
+// NewManualSolver creates a new manual solver.
+func NewManualSolver() *ManualSolver {
+	return &ManualSolver{pending: make(map[string]*PendingTask)}
+}
+
+// Solve waits for an operator to solve the captcha.
+func (m *ManualSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return m.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also shows the widget parameters.
+func (m *ManualSolver) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(m, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask publishes task and waits for its token until the task's context
+// is done or Timeout passes.
+func (m *ManualSolver) SolveTask(task *Task) (*Result, error) {
+	start := time.Now()
+	ctx := task.Context()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, orDefault(m.Timeout, DefaultManualTimeout))
+		defer cancel()
+	}
+
+	p := &PendingTask{
+		Type:    task.Type,
+		PageURL: task.PageURL,
+		SiteKey: task.SiteKey,
+		Params:  task.Params,
+		Created: start,
+		token:   make(chan string, 1),
+	}
+	m.mu.Lock()
+	if m.pending == nil {
+		m.pending = make(map[string]*PendingTask)
+	}
+	m.seq++
+	p.ID = strconv.Itoa(m.seq)
+	m.pending[p.ID] = p
+	m.mu.Unlock()
+	defer m.remove(p.ID)
+
+	if m.Notify != nil {
+		select {
+		case m.Notify <- p:
+		default:
+		}
+	}
+
+	select {
+	case token := <-p.token:
+		return &Result{Token: token, SolverID: "manual", TaskID: p.ID, SolveTime: time.Since(start)}, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("manual: no token for task %s: %w", p.ID, ctx.Err())
+	}
+}
+
+// Pending returns the tasks waiting for a token, oldest first.
+func (m *ManualSolver) Pending() []*PendingTask {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tasks := make([]*PendingTask, 0, len(m.pending))
+	for _, p := range m.pending {
+		tasks = append(tasks, p)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Created.Before(tasks[j].Created) })
+	return tasks
+}
+
+// Resolve provides the token for the task with the given ID.
+func (m *ManualSolver) Resolve(id, token string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return errors.New("captcha: empty token")
+	}
+	m.mu.Lock()
+	p, ok := m.pending[id]
+	delete(m.pending, id)
+	m.mu.Unlock()
+	if !ok {
+		return ErrUnknownTask
+	}
+	p.token <- token
+	return nil
+}
+
+func (m *ManualSolver) remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pending, id)
+}
+
+// ServeHTTP serves the operator page. GET / lists the pending tasks, GET
+// /tasks lists them as JSON, and POST /tasks/{id} with a token form field
+// resolves a task. Links are relative, so the page can be mounted under a
+// prefix with http.StripPrefix.
+func (m *ManualSolver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := manualPage.Execute(w, m.Pending()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/tasks":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(m.Pending())
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/tasks/"):
+		err := m.Resolve(strings.TrimPrefix(r.URL.Path, "/tasks/"), r.FormValue("token"))
+		switch {
+		case errors.Is(err, ErrUnknownTask):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case strings.Contains(r.Header.Get("Accept"), "text/html"):
+			// Relative, so that the page also works behind http.StripPrefix.
+			w.Header().Set("Location", "../")
+			w.WriteHeader(http.StatusSeeOther)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var manualPage = template.Must(template.New("manual").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Pending captchas ({{len .}})</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.task { border: 1px solid #ccc; padding: 1em; margin-bottom: 1em; }
+textarea { width: 100%; }
+</style>
+</head>
+<body>
+<h1>Pending captchas</h1>
+{{range .}}
+<div class="task">
+  <p><b>{{.Type}}</b> #{{.ID}}, waiting since {{.Created.Format "15:04:05"}}</p>
+  <p>Page: <a href="{{.PageURL}}" target="_blank" rel="noreferrer">{{.PageURL}}</a><br>
+  Site key: <code>{{.SiteKey}}</code>
+  {{with .Params.Action}}<br>Action: <code>{{.}}</code>{{end}}
+  {{with .Params.CData}}<br>cData: <code>{{.}}</code>{{end}}</p>
+  <form method="POST" action="tasks/{{.ID}}">
+    <textarea name="token" rows="3" placeholder="Paste the token"></textarea>
+    <button type="submit">Submit</button>
+  </form>
+</div>
+{{else}}
+<p>No captcha is waiting.</p>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,107 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManualSolver_Notify(t *testing.T) {
+	notify := make(chan *PendingTask, 1)
+	m := NewManualSolver()
+	m.Notify = notify
+
+	go func() {
+		p := <-notify
+		if p.SiteKey != "0x4AAA" || p.Type != Turnstile {
+			t.Errorf("pending task = %+v", p)
+		}
+		if err := m.Resolve(p.ID, " tok \n"); err != nil {
+			t.Errorf("Resolve: %v", err)
+		}
+	}()
+
+	res, err := m.SolveTask(&Task{Type: Turnstile, PageURL: "https://example.com/", SiteKey: "0x4AAA"})
+	if err != nil {
+		t.Fatalf("SolveTask: %v", err)
+	}
+	if res.Token != "tok" || res.SolverID != "manual" {
+		t.Errorf("result = %+v", res)
+	}
+	if len(m.Pending()) != 0 {
+		t.Error("resolved task is still pending")
+	}
+	if err := m.Resolve(res.TaskID, "again"); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("second Resolve error = %v, want ErrUnknownTask", err)
+	}
+}
+
+func TestManualSolver_HTTP(t *testing.T) {
+	m := NewManualSolver()
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	done := make(chan string)
+	go func() {
+		token, err := m.Solve(HCaptcha, "https://example.com/login", "a5f74b19-9e45-40e0-b45d-47ff91b7a6c2")
+		if err != nil {
+			t.Errorf("Solve: %v", err)
+		}
+		done <- token
+	}()
+
+	var pending []*PendingTask
+	for deadline := time.Now().Add(time.Second); len(pending) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		pending = m.Pending()
+	}
+	if len(pending) != 1 {
+		t.Fatalf("pending = %v", pending)
+	}
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "a5f74b19-9e45-40e0-b45d-47ff91b7a6c2") || !strings.Contains(string(page), `action="tasks/`+pending[0].ID+`"`) {
+		t.Errorf("page does not show the task:\n%s", page)
+	}
+
+	resp, err = http.PostForm(server.URL+"/tasks/"+pending[0].ID, url.Values{"token": {"P1_token"}})
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("POST status = %d", resp.StatusCode)
+	}
+	if token := <-done; token != "P1_token" {
+		t.Errorf("token = %q", token)
+	}
+
+	resp, _ = http.PostForm(server.URL+"/tasks/"+pending[0].ID, url.Values{"token": {"late"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST for a resolved task: status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestManualSolver_Timeout(t *testing.T) {
+	m := NewManualSolver()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.SolveTask((&Task{Type: Turnstile}).WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the context's deadline", err)
+	}
+	if len(m.Pending()) != 0 {
+		t.Error("abandoned task is still pending")
+	}
+}
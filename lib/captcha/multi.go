@@ -0,0 +1,242 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive failures after which
+	// a MultiSolver stops using a provider for Cooldown.
+	DefaultFailureThreshold = 3
+	// DefaultCooldown is how long a failing provider is skipped.
+	DefaultCooldown = time.Minute
+)
+
+// ErrNoSolverAvailable is returned by a MultiSolver when every provider is
+// cooling down after repeated failures.
+var ErrNoSolverAvailable = errors.New("captcha: no solver available")
+
+// Strategy is how a MultiSolver uses its providers.
+type Strategy int
+
+const (
+	// Fallback tries the providers one after the other, in order, until one
+	// returns a token.
+	Fallback Strategy = iota
+	// Race asks all providers at once and cancels the others as soon as one
+	// returns a token.
+	Race
+)
+
+// Provider is a solver used by a MultiSolver.
+type Provider struct {
+	// Name identifies the provider in errors. It defaults to the solver's type.
+	Name   string
+	Solver Solver
+	// Timeout bounds each attempt with this provider. Zero means no limit
+	// other than the task's context.
+	Timeout time.Duration
+}
+
+// MultiSolver combines several providers so that an outage of one does not
+// fail every challenge. Providers that fail FailureThreshold times in a row
+// are skipped for Cooldown, after which a single attempt decides whether they
+// are used again.
+type MultiSolver struct {
+	Strategy         Strategy
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	members []*member
+}
+
+// member is a provider and its circuit-breaker state.
+type member struct {
+	Provider
+	ts TaskSolver
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewFallbackSolver returns a MultiSolver trying providers in order.
+func NewFallbackSolver(providers ...Provider) *MultiSolver {
+	return newMultiSolver(Fallback, providers)
+}
+
+// NewRaceSolver returns a MultiSolver racing providers in parallel.
+func NewRaceSolver(providers ...Provider) *MultiSolver {
+	return newMultiSolver(Race, providers)
+}
+
+func newMultiSolver(strategy Strategy, providers []Provider) *MultiSolver {
+	m := &MultiSolver{
+		Strategy:         strategy,
+		FailureThreshold: DefaultFailureThreshold,
+		Cooldown:         DefaultCooldown,
+	}
+	for _, p := range providers {
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("%T", p.Solver)
+		}
+		m.members = append(m.members, &member{Provider: p, ts: AsTaskSolver(p.Solver)})
+	}
+	return m
+}
+
+// Solve solves a captcha with the providers.
+func (m *MultiSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return m.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+// SolveWithParams is like Solve but also forwards the widget parameters.
+func (m *MultiSolver) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(m, captchaType, pageURL, siteKey, params)
+}
+
+// SolveTask solves task with the providers according to the strategy.
+func (m *MultiSolver) SolveTask(task *Task) (*Result, error) {
+	if m.Strategy == Race {
+		return m.race(task)
+	}
+	return m.fallback(task)
+}
+
+// fallback tries the providers in order. A provider's circuit is only
+// consulted just before its turn, so that a half-open provider is not marked
+// as probing when an earlier one returns a token.
+func (m *MultiSolver) fallback(task *Task) (*Result, error) {
+	var errs []error
+	for _, mb := range m.members {
+		if !mb.allow(time.Now()) {
+			continue
+		}
+		res, err := m.attempt(task.Context(), task, mb)
+		if err == nil {
+			return res, nil
+		}
+		errs = append(errs, err)
+		if task.Context().Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoSolverAvailable
+	}
+	return nil, fmt.Errorf("captcha: all solvers failed: %w", errors.Join(errs...))
+}
+
+// race asks every available provider at once.
+func (m *MultiSolver) race(task *Task) (*Result, error) {
+	var members []*member
+	now := time.Now()
+	for _, mb := range m.members {
+		if mb.allow(now) {
+			members = append(members, mb)
+		}
+	}
+	if len(members) == 0 {
+		return nil, ErrNoSolverAvailable
+	}
+
+	ctx, cancel := context.WithCancel(task.Context())
+	defer cancel()
+
+	type outcome struct {
+		res *Result
+		err error
+	}
+	outcomes := make(chan outcome, len(members))
+	for _, mb := range members {
+		go func(mb *member) {
+			res, err := m.attempt(ctx, task, mb)
+			outcomes <- outcome{res, err}
+		}(mb)
+	}
+
+	var errs []error
+	for range members {
+		o := <-outcomes
+		if o.err == nil {
+			return o.res, nil
+		}
+		errs = append(errs, o.err)
+	}
+	return nil, fmt.Errorf("captcha: all solvers failed: %w", errors.Join(errs...))
+}
+
+// attempt solves task with mb under ctx and the provider's timeout, and
+// updates the provider's circuit. Attempts cut short by ctx, because the
+// caller gave up or another provider won the race, do not count as failures.
+func (m *MultiSolver) attempt(ctx context.Context, task *Task, mb *member) (*Result, error) {
+	attemptCtx := ctx
+	if mb.Timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, mb.Timeout)
+		defer cancel()
+	}
+
+	res, err := mb.ts.SolveTask(task.WithContext(attemptCtx))
+	switch {
+	case err == nil:
+		mb.record(true, m.FailureThreshold, m.Cooldown)
+		if res.SolverID == "" {
+			res.SolverID = mb.Name
+		}
+		return res, nil
+	case ctx.Err() != nil:
+		mb.release()
+	default:
+		mb.record(false, m.FailureThreshold, m.Cooldown)
+	}
+	return nil, fmt.Errorf("%s: %w", mb.Name, err)
+}
+
+// allow reports whether the provider may be used. Once the cooldown is over,
+// a single probing attempt is let through.
+func (mb *member) allow(now time.Time) bool {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(mb.openUntil) || mb.probing {
+		return false
+	}
+	mb.probing = true
+	return true
+}
+
+// record updates the circuit after an attempt.
+func (mb *member) record(ok bool, threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.probing = false
+	if ok {
+		mb.failures, mb.openUntil = 0, time.Time{}
+		return
+	}
+	mb.failures++
+	if mb.failures >= threshold || !mb.openUntil.IsZero() {
+		mb.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+// release ends a probing attempt that was cancelled before it could decide.
+func (mb *member) release() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.probing = false
+}
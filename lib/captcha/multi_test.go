@@ -0,0 +1,154 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSolver returns token after delay, or err, and counts its calls.
+type fakeSolver struct {
+	token string
+	err   error
+	delay time.Duration
+	calls atomic.Int32
+	// cancelled is set when the task's context ended before the delay.
+	cancelled atomic.Bool
+}
+
+func (f *fakeSolver) SolveTask(task *Task) (*Result, error) {
+	f.calls.Add(1)
+	select {
+	case <-time.After(f.delay):
+	case <-task.Context().Done():
+		f.cancelled.Store(true)
+		return nil, task.Context().Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Result{Token: f.token}, nil
+}
+
+func (f *fakeSolver) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return solveWithParams(f, captchaType, pageURL, siteKey, Params{})
+}
+
+func TestMultiSolver_Fallback(t *testing.T) {
+	down := &fakeSolver{err: errors.New("service unavailable")}
+	slow := &fakeSolver{token: "slow", delay: time.Second}
+	up := &fakeSolver{token: "up"}
+	m := NewFallbackSolver(
+		Provider{Name: "down", Solver: down},
+		Provider{Name: "slow", Solver: slow, Timeout: 10 * time.Millisecond},
+		Provider{Name: "up", Solver: up},
+	)
+
+	res, err := m.SolveTask(&Task{Type: Turnstile})
+	if err != nil {
+		t.Fatalf("SolveTask: %v", err)
+	}
+	if res.Token != "up" || res.SolverID != "up" {
+		t.Errorf("result = %+v, want the third provider's", res)
+	}
+	if !slow.cancelled.Load() {
+		t.Error("the slow provider should have been cut off by its timeout")
+	}
+}
+
+func TestMultiSolver_Race(t *testing.T) {
+	fast := &fakeSolver{token: "fast", delay: 5 * time.Millisecond}
+	slow := &fakeSolver{token: "slow", delay: time.Second}
+	m := NewRaceSolver(Provider{Name: "slow", Solver: slow}, Provider{Name: "fast", Solver: fast})
+
+	res, err := m.SolveTask(&Task{Type: Turnstile})
+	if err != nil {
+		t.Fatalf("SolveTask: %v", err)
+	}
+	if res.Token != "fast" {
+		t.Errorf("token = %q, want the fastest provider's", res.Token)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !slow.cancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !slow.cancelled.Load() {
+		t.Error("the losing provider was not cancelled")
+	}
+}
+
+func TestMultiSolver_CircuitBreaker(t *testing.T) {
+	down := &fakeSolver{err: errors.New("service unavailable")}
+	up := &fakeSolver{token: "up"}
+	m := NewFallbackSolver(Provider{Name: "down", Solver: down}, Provider{Name: "up", Solver: up})
+	m.FailureThreshold = 2
+	m.Cooldown = 20 * time.Millisecond
+
+	for i := 0; i < 4; i++ {
+		if _, err := m.SolveTask(&Task{Type: Turnstile}); err != nil {
+			t.Fatalf("SolveTask: %v", err)
+		}
+	}
+	if got := down.calls.Load(); got != 2 {
+		t.Errorf("failing provider called %d times, want 2 before its circuit opens", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := m.SolveTask(&Task{Type: Turnstile}); err != nil {
+		t.Fatalf("SolveTask: %v", err)
+	}
+	if got := down.calls.Load(); got != 3 {
+		t.Errorf("failing provider called %d times, want one probe after the cooldown", got)
+	}
+
+	only := NewFallbackSolver(Provider{Name: "down", Solver: down})
+	only.FailureThreshold = 1
+	if _, err := only.SolveTask(&Task{}); err == nil {
+		t.Fatal("expected the provider's error")
+	}
+	if _, err := only.SolveTask(&Task{}); !errors.Is(err, ErrNoSolverAvailable) {
+		t.Errorf("error = %v, want ErrNoSolverAvailable", err)
+	}
+}
+
+func TestMultiSolver_CallerCancelDoesNotTrip(t *testing.T) {
+	slow := &fakeSolver{token: "slow", delay: time.Second}
+	m := NewFallbackSolver(Provider{Name: "slow", Solver: slow})
+	m.FailureThreshold = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := m.SolveTask((&Task{}).WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the caller's deadline", err)
+	}
+	if !m.members[0].allow(time.Now()) {
+		t.Error("a cancelled attempt opened the provider's circuit")
+	}
+}
+
+func TestMultiSolver_FallbackProbesLazily(t *testing.T) {
+	a := &fakeSolver{err: errors.New("a down")}
+	b := &fakeSolver{err: errors.New("b down")}
+	m := NewFallbackSolver(Provider{Name: "a", Solver: a}, Provider{Name: "b", Solver: b})
+	m.FailureThreshold = 1
+	m.Cooldown = 10 * time.Millisecond
+
+	if _, err := m.SolveTask(&Task{}); err == nil {
+		t.Fatal("expected both providers to fail")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// a's probe succeeds, so b is not tried and must stay available for a probe.
+	a.err, a.token = nil, "a"
+	if res, err := m.SolveTask(&Task{}); err != nil || res.Token != "a" {
+		t.Fatalf("SolveTask = %+v, %v; want a's token", res, err)
+	}
+	a.err = errors.New("a down again")
+	b.err, b.token = nil, "b"
+	res, err := m.SolveTask(&Task{})
+	if err != nil || res.Token != "b" {
+		t.Fatalf("SolveTask = %+v, %v; want the half-open provider b to be probed", res, err)
+	}
+}
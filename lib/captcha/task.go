@@ -0,0 +1,156 @@
+package captcha
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Task describes a captcha to solve and the browser context it appears in.
+// Providers that solve in their own browsers need the proxy, user agent and
+// cookies to produce a token Cloudflare accepts for the scraper's session.
+type Task struct {
+	// Type is one of Turnstile, HCaptcha or ReCaptcha.
+	Type string
+	// PageURL is the URL of the page showing the captcha.
+	PageURL string
+	// SiteKey is the widget's site key.
+	SiteKey string
+	// Params holds the widget parameters found on the page.
+	Params Params
+	// Extra holds provider-specific fields, passed through verbatim.
+	Extra map[string]string
+
+	// Proxy is the proxy the scraper sent the challenged request through, or
+	// nil for a direct connection.
+	Proxy *url.URL
+	// UserAgent is the User-Agent of the challenged request.
+	UserAgent string
+	// Cookies are the scraper's cookies for PageURL.
+	Cookies []*http.Cookie
+
+	ctx context.Context
+}
+
+// Context returns the task's context. It is never nil; it defaults to the
+// background context.
+func (t *Task) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// WithContext returns a shallow copy of t with its context changed to ctx.
+// Solvers stop waiting for a token once ctx is done.
+func (t *Task) WithContext(ctx context.Context) *Task {
+	if ctx == nil {
+		panic("captcha: nil context")
+	}
+	t2 := *t
+	t2.ctx = ctx
+	return &t2
+}
+
+// Result is a solved captcha.
+type Result struct {
+	// Token is the response to submit with the challenge form.
+	Token string
+	// Cost is what the provider charged for the solve, in USD, or zero if unknown.
+	Cost float64
+	// SolverID names the solver that produced the token, e.g. "2captcha".
+	SolverID string
+	// TaskID is the provider's identifier of the job, used to report the token.
+	TaskID string
+	// SolveTime is how long the solve took.
+	SolveTime time.Duration
+	// UserAgent is the User-Agent the provider solved with, if it reported one.
+	// Cloudflare binds the clearance to the User-Agent that solved the widget.
+	UserAgent string
+	// Reporter takes feedback on the token, or is nil if the provider does not
+	// accept any. Solvers implementing Reporter set it to themselves.
+	Reporter Reporter
+}
+
+// Reporter is implemented by solvers whose provider accepts feedback on the
+// tokens it returned. Providers refund rejected tokens and use the reports to
+// rate their workers. Both methods identify the job by the result's TaskID.
+type Reporter interface {
+	// ReportBad reports a token the site rejected.
+	ReportBad(result *Result) error
+	// ReportGood reports a token the site accepted.
+	ReportGood(result *Result) error
+}
+
+// TaskSolver solves captcha tasks.
+type TaskSolver interface {
+	SolveTask(task *Task) (*Result, error)
+}
+
+// AsTaskSolver returns s as a TaskSolver. Solvers that only implement Solver
+// or ParamSolver are adapted: they receive the fields they understand, and
+// the adapter stops waiting for them once the task's context is done.
+func AsTaskSolver(s Solver) TaskSolver {
+	if ts, ok := s.(TaskSolver); ok {
+		return ts
+	}
+	return solverAdapter{s}
+}
+
+type solverAdapter struct {
+	Solver
+}
+
+func (a solverAdapter) SolveTask(task *Task) (*Result, error) {
+	type outcome struct {
+		token string
+		err   error
+	}
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		if ps, ok := a.Solver.(ParamSolver); ok {
+			o.token, o.err = ps.SolveWithParams(task.Type, task.PageURL, task.SiteKey, task.Params)
+		} else {
+			o.token, o.err = a.Solve(task.Type, task.PageURL, task.SiteKey)
+		}
+		done <- o
+	}()
+
+	ctx := task.Context()
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return nil, o.err
+		}
+		res := &Result{Token: o.token, SolveTime: time.Since(start)}
+		res.Reporter, _ = a.Solver.(Reporter)
+		return res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// AsSolver returns a Solver backed by ts, for use where a Solver is expected,
+// such as cloudscraper.WithCaptchaSolver. The returned value also implements
+// ParamSolver and TaskSolver, so no task field is lost.
+func AsSolver(ts TaskSolver) Solver {
+	if s, ok := ts.(Solver); ok {
+		return s
+	}
+	return taskSolverAdapter{ts}
+}
+
+type taskSolverAdapter struct {
+	TaskSolver
+}
+
+func (a taskSolverAdapter) Solve(captchaType, pageURL, siteKey string) (string, error) {
+	return a.SolveWithParams(captchaType, pageURL, siteKey, Params{})
+}
+
+func (a taskSolverAdapter) SolveWithParams(captchaType, pageURL, siteKey string, params Params) (string, error) {
+	return solveWithParams(a, captchaType, pageURL, siteKey, params)
+}
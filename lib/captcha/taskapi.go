@@ -0,0 +1,246 @@
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default endpoints of the createTask-style solvers.
+const (
+	AntiCaptchaBaseURL = "https://api.anti-captcha.com"
+	CapMonsterBaseURL  = "https://api.capmonster.cloud"
+	CapSolverBaseURL   = "https://api.capsolver.com"
+)
+
+const (
+	// DefaultPollInterval is how often solvers ask the provider for the result.
+	DefaultPollInterval = 5 * time.Second
+	// DefaultSolveTimeout is how long solvers wait for a result when the task's
+	// context has no deadline.
+	DefaultSolveTimeout = 180 * time.Second
+)
+
+// taskAPI is a client for the createTask/getTaskResult JSON API shared by
+// Anti-Captcha, CapMonster and CapSolver.
+type taskAPI struct {
+	name         string
+	baseURL      string
+	apiKey       string
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+// newTaskAPI returns a client for the given solver settings, using defaultURL,
+// http.DefaultClient and DefaultPollInterval for those left unset.
+func newTaskAPI(name, baseURL, defaultURL, apiKey string, client *http.Client, pollInterval time.Duration) *taskAPI {
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &taskAPI{
+		name:         name,
+		baseURL:      baseURL,
+		apiKey:       apiKey,
+		client:       client,
+		pollInterval: orDefault(pollInterval, DefaultPollInterval),
+	}
+}
+
+type taskAPIResponse struct {
+	ErrorID          int          `json:"errorId"`
+	ErrorCode        string       `json:"errorCode"`
+	ErrorDescription string       `json:"errorDescription"`
+	TaskID           flexString   `json:"taskId"`
+	Status           string       `json:"status"`
+	Solution         taskSolution `json:"solution"`
+	Cost             flexString   `json:"cost"`
+	Balance          float64      `json:"balance"`
+}
+
+type taskSolution struct {
+	GRecaptchaResponse string `json:"gRecaptchaResponse"`
+	Token              string `json:"token"`
+	UserAgent          string `json:"userAgent"`
+}
+
+func (s taskSolution) token() string {
+	if s.Token != "" {
+		return s.Token
+	}
+	return s.GRecaptchaResponse
+}
+
+// flexString accepts both JSON strings and numbers; providers disagree on the
+// type of task IDs and costs.
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*f = flexString(s)
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	*f = flexString(data)
+	return nil
+}
+
+// solve creates a task with the given provider payload and polls for its
+// solution until the task's context is done or DefaultSolveTimeout passes.
+func (a *taskAPI) solve(task *Task, payload map[string]any) (*Result, error) {
+	start := time.Now()
+	ctx := task.Context()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultSolveTimeout)
+		defer cancel()
+	}
+
+	for key, value := range task.Extra {
+		payload[key] = value
+	}
+	created, err := a.createTask(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	taskID := string(created.TaskID)
+	if taskID == "" {
+		return nil, fmt.Errorf("%s: createTask returned no task ID", a.name)
+	}
+
+	res := created
+	for res.Status != "ready" {
+		select {
+		case <-time.After(a.pollInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s: timeout waiting for solve: %w", a.name, ctx.Err())
+		}
+		res, err = a.call(ctx, "getTaskResult", map[string]any{"clientKey": a.apiKey, "taskId": json.RawMessage(jsonTaskID(taskID))})
+		if err != nil {
+			return nil, err
+		}
+		if res.Status == "failed" {
+			return nil, fmt.Errorf("%s: task %s failed", a.name, taskID)
+		}
+	}
+
+	token := res.Solution.token()
+	if token == "" {
+		return nil, fmt.Errorf("%s: task %s returned no token", a.name, taskID)
+	}
+	cost, _ := strconv.ParseFloat(string(res.Cost), 64)
+	userAgent := res.Solution.UserAgent
+	if userAgent == "" {
+		userAgent = task.UserAgent
+	}
+	return &Result{
+		Token:     token,
+		Cost:      cost,
+		SolverID:  a.name,
+		TaskID:    taskID,
+		SolveTime: time.Since(start),
+		UserAgent: userAgent,
+	}, nil
+}
+
+// createTask creates the task, retrying temporary errors with backoff until
+// ctx is done, in which case the last of them is returned.
+func (a *taskAPI) createTask(ctx context.Context, payload map[string]any) (*taskAPIResponse, error) {
+	for retry := 0; ; retry++ {
+		res, err := a.call(ctx, "createTask", map[string]any{"clientKey": a.apiKey, "task": payload})
+		if err == nil || !isTemporary(err) {
+			return res, err
+		}
+		if sleep(ctx, backoff(a.pollInterval, retry)) != nil {
+			return nil, err
+		}
+	}
+}
+
+// balance returns the account balance.
+func (a *taskAPI) balance(ctx context.Context) (float64, error) {
+	res, err := a.call(ctx, "getBalance", map[string]any{"clientKey": a.apiKey})
+	if err != nil {
+		return 0, err
+	}
+	return res.Balance, nil
+}
+
+// jsonTaskID encodes a task ID the way the provider sent it: numeric IDs as
+// numbers, anything else as a string.
+func jsonTaskID(id string) string {
+	if _, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return id
+	}
+	b, _ := json.Marshal(id)
+	return string(b)
+}
+
+// call posts body to the given API method and decodes the response, turning
+// provider errors into Go errors.
+func (a *taskAPI) call(ctx context.Context, method string, body map[string]any) (*taskAPIResponse, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to encode %s request: %w", a.name, method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(a.baseURL, "/")+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to build %s request: %w", a.name, method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s failed: %w", a.name, method, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var res taskAPIResponse
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse %s response: %s", a.name, method, string(respBody))
+	}
+	if res.ErrorID != 0 {
+		return nil, newProviderError(a.name, res.ErrorCode, res.ErrorDescription)
+	}
+	return &res, nil
+}
+
+// setIf sets payload[key] to value unless value is the zero value.
+func setIf[T comparable](payload map[string]any, key string, value T) {
+	var zero T
+	if value != zero {
+		payload[key] = value
+	}
+}
+
+// cookieHeader formats cookies as a Cookie header value.
+func cookieHeader(cookies []*http.Cookie) string {
+	pairs := make([]string, len(cookies))
+	for i, c := range cookies {
+		pairs[i] = c.Name + "=" + c.Value
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// solveWithParams implements SolveWithParams on top of a TaskSolver.
+func solveWithParams(ts TaskSolver, captchaType, pageURL, siteKey string, params Params) (string, error) {
+	res, err := ts.SolveTask(&Task{Type: captchaType, PageURL: pageURL, SiteKey: siteKey, Params: params})
+	if err != nil {
+		return "", err
+	}
+	return res.Token, nil
+}
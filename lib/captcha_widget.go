@@ -0,0 +1,123 @@
+package cloudscraper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Advik-B/cloudscraper/lib/captcha"
+)
+
+// captchaWidget identifies the captcha widget embedded in a challenge page. Its
+// value is the captcha type passed to captcha.Solver.
+type captchaWidget string
+
+const (
+	widgetTurnstile captchaWidget = captcha.Turnstile
+	widgetHCaptcha  captchaWidget = captcha.HCaptcha
+	widgetReCaptcha captchaWidget = captcha.ReCaptcha
+)
+
+var (
+	turnstileKeyRegex = regexp.MustCompile(`^0x[\w-]+$`)
+	hCaptchaKeyRegex  = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	reCaptchaKeyRegex = regexp.MustCompile(`^6L[\w-]{38}$`)
+)
+
+// widgetClasses maps the class name each widget's container uses to the widget.
+var widgetClasses = map[string]captchaWidget{
+	"cf-turnstile": widgetTurnstile,
+	"h-captcha":    widgetHCaptcha,
+	"g-recaptcha":  widgetReCaptcha,
+}
+
+// captchaPage describes the captcha widget found on a challenge page.
+type captchaPage struct {
+	Widget  captchaWidget
+	SiteKey string
+	Params  captcha.Params
+}
+
+// parseCaptchaPage finds the captcha widget of a challenge page, identifies its
+// type and extracts the parameters a solver needs to produce an accepted token.
+// body is the raw page that was tokenized into page.
+func parseCaptchaPage(page *challengePage, body string) (*captchaPage, error) {
+	attrs := page.Widget
+	opt := parseChlOpt(body)
+
+	cp := &captchaPage{SiteKey: attrs["data-sitekey"]}
+	if cp.SiteKey == "" {
+		// Modern Cloudflare pages render Turnstile from _cf_chl_opt.
+		cp.SiteKey = opt["chlApiSitekey"]
+	}
+	if cp.SiteKey == "" {
+		return nil, fmt.Errorf("captcha: could not find site key")
+	}
+	cp.Widget = identifyCaptchaWidget(attrs["class"], page.ScriptSrcs, cp.SiteKey)
+
+	cp.Params = captcha.Params{
+		Action:    attrs["data-action"],
+		CData:     attrs["data-cdata"],
+		RQData:    attrs["data-rqdata"],
+		Invisible: strings.EqualFold(attrs["data-size"], "invisible"),
+	}
+	switch cp.Widget {
+	case widgetTurnstile:
+		cp.Params.PageData = opt["chlPageData"]
+		if cp.Params.CData == "" {
+			cp.Params.CData = opt["cData"]
+		}
+	case widgetReCaptcha:
+		for _, src := range page.ScriptSrcs {
+			if strings.Contains(src, "/recaptcha/enterprise.js") {
+				cp.Params.Enterprise = true
+			}
+		}
+	case widgetHCaptcha:
+		cp.Params.Enterprise = cp.Params.RQData != ""
+	}
+	return cp, nil
+}
+
+// identifyCaptchaWidget determines the widget type from, in order of
+// reliability, the container's class names, the widget scripts the page loads
+// and the format of the site key. Cloudflare serves Turnstile by default.
+func identifyCaptchaWidget(class string, scripts []string, siteKey string) captchaWidget {
+	for _, name := range strings.Fields(class) {
+		if w, ok := widgetClasses[name]; ok {
+			return w
+		}
+	}
+	for _, src := range scripts {
+		switch {
+		case strings.Contains(src, "challenges.cloudflare.com/turnstile/"):
+			return widgetTurnstile
+		case strings.Contains(src, "hcaptcha.com/1/api.js"):
+			return widgetHCaptcha
+		case strings.Contains(src, "/recaptcha/api.js"), strings.Contains(src, "/recaptcha/enterprise.js"):
+			return widgetReCaptcha
+		}
+	}
+	switch {
+	case turnstileKeyRegex.MatchString(siteKey):
+		return widgetTurnstile
+	case hCaptchaKeyRegex.MatchString(siteKey):
+		return widgetHCaptcha
+	case reCaptchaKeyRegex.MatchString(siteKey):
+		return widgetReCaptcha
+	}
+	return widgetTurnstile
+}
+
+// responseFields returns the form fields the widget fills with its token when
+// the visitor passes it.
+func (w captchaWidget) responseFields() []string {
+	switch w {
+	case widgetHCaptcha:
+		// hCaptcha also populates g-recaptcha-response for reCAPTCHA compatibility.
+		return []string{"h-captcha-response", "g-recaptcha-response"}
+	case widgetReCaptcha:
+		return []string{"g-recaptcha-response"}
+	}
+	return []string{"cf-turnstile-response"}
+}
@@ -0,0 +1,291 @@
+package cloudscraper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/captcha"
+	"github.com/Advik-B/cloudscraper/lib/captcha/captchatest"
+	"github.com/Advik-B/cloudscraper/lib/cftest"
+	"github.com/Advik-B/cloudscraper/lib/stealth"
+)
+
+// stubSolver returns a fixed token and records what it was asked to solve.
+type stubSolver struct {
+	token       string
+	captchaType string
+	siteKey     string
+}
+
+func (s *stubSolver) Solve(captchaType, url, siteKey string) (string, error) {
+	s.captchaType, s.siteKey = captchaType, siteKey
+	return s.token, nil
+}
+
+func TestParseCaptchaPage(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		widget captchaWidget
+		params captcha.Params
+	}{
+		{
+			name:   "turnstile class",
+			body:   `<div class="cf-turnstile" data-sitekey="0x4AAAAAAA" data-action="login" data-cdata="abc"></div>`,
+			widget: widgetTurnstile,
+			params: captcha.Params{Action: "login", CData: "abc"},
+		},
+		{
+			name:   "hcaptcha class with rqdata",
+			body:   `<div class="h-captcha" data-sitekey="a5f74b19-9e45-40e0-b45d-47ff91b7a6c2" data-rqdata="rq" data-size="invisible"></div>`,
+			widget: widgetHCaptcha,
+			params: captcha.Params{RQData: "rq", Invisible: true, Enterprise: true},
+		},
+		{
+			name:   "recaptcha enterprise script",
+			body:   `<script src="https://www.google.com/recaptcha/enterprise.js"></script><div data-sitekey="6LeIxAcTAAAAAJcZVRqyHh71UMIEGNQ_MXjiZKhI"></div>`,
+			widget: widgetReCaptcha,
+			params: captcha.Params{Enterprise: true},
+		},
+		{
+			name:   "hcaptcha script",
+			body:   `<script src="https://js.hcaptcha.com/1/api.js" async></script><div id="w" data-sitekey="custom-key"></div>`,
+			widget: widgetHCaptcha,
+		},
+		{
+			name:   "recaptcha site key format",
+			body:   `<div id="w" data-sitekey="6LeIxAcTAAAAAJcZVRqyHh71UMIEGNQ_MXjiZKhI"></div>`,
+			widget: widgetReCaptcha,
+		},
+		{
+			name:   "turnstile from _cf_chl_opt",
+			body:   `<script>window._cf_chl_opt={cType: 'managed',chlApiSitekey: '0x4AAAAAAB',chlPageData: 'pd'};</script>`,
+			widget: widgetTurnstile,
+			params: captcha.Params{PageData: "pd"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := parseCaptchaPage(parseChallengePage(tt.body), tt.body)
+			if err != nil {
+				t.Fatalf("parseCaptchaPage: %v", err)
+			}
+			if page.Widget != tt.widget {
+				t.Errorf("widget = %q, want %q", page.Widget, tt.widget)
+			}
+			if page.Params != tt.params {
+				t.Errorf("params = %+v, want %+v", page.Params, tt.params)
+			}
+		})
+	}
+
+	if _, err := parseCaptchaPage(parseChallengePage(`<html></html>`), `<html></html>`); err == nil {
+		t.Error("expected an error for a page without a site key")
+	}
+}
+
+// TestSolveCaptchaChallenge_DynamicForm asserts that a managed Turnstile page
+// without a <form> is submitted to the _cf_chl_opt form action, with its hidden
+// fields and only the Turnstile response field.
+func TestSolveCaptchaChallenge_DynamicForm(t *testing.T) {
+	var submitted map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Query().Get("__cf_chl_f_tk") == "tok" {
+			_ = r.ParseForm()
+			submitted = r.PostForm
+			_, _ = io.WriteString(w, "welcome")
+			return
+		}
+		w.Header().Set("Server", "cloudflare")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `<html><head><title>Just a moment...</title></head><body>
+<div class="cf-turnstile" data-sitekey="0x4AAAAAAAtest"></div>
+<script>(function(){window._cf_chl_opt={cvId: '3',cType: 'managed',cRay: '8a1b',fa: "/page?__cf_chl_f_tk=tok",md: 'hidden-md'};})();</script>
+</body></html>`)
+	}))
+	defer server.Close()
+
+	solver := &stubSolver{token: "solved-token"}
+	s, err := New(
+		WithCaptchaSolver(solver),
+		WithSessionConfig(false, time.Hour, 0),
+		WithStealth(stealth.Options{Enabled: false}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	resp, err := s.Get(server.URL + "/page")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	drainBody(resp)
+
+	if solver.captchaType != captcha.Turnstile || solver.siteKey != "0x4AAAAAAAtest" {
+		t.Errorf("solver asked for %q with site key %q", solver.captchaType, solver.siteKey)
+	}
+	if got := submitted["cf-turnstile-response"]; len(got) != 1 || got[0] != "solved-token" {
+		t.Errorf("cf-turnstile-response = %v", got)
+	}
+	if got := submitted["md"]; len(got) != 1 || got[0] != "hidden-md" {
+		t.Errorf("md = %v", got)
+	}
+	if _, ok := submitted["g-recaptcha-response"]; ok {
+		t.Error("g-recaptcha-response should not be sent for a Turnstile widget")
+	}
+}
+
+// taskSolver implements only captcha.TaskSolver and records the task.
+type taskSolver struct {
+	task *captcha.Task
+}
+
+func (s *taskSolver) SolveTask(task *captcha.Task) (*captcha.Result, error) {
+	s.task = task
+	return &captcha.Result{Token: "task-token", SolverID: "stub"}, nil
+}
+
+// TestSolveCaptchaChallenge_Task asserts that task solvers receive the browser
+// context of the challenged request along with the widget.
+func TestSolveCaptchaChallenge_Task(t *testing.T) {
+	var submitted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			_ = r.ParseForm()
+			submitted = r.PostForm.Get("cf-turnstile-response")
+			_, _ = io.WriteString(w, "welcome")
+			return
+		}
+		w.Header().Set("Server", "cloudflare")
+		http.SetCookie(w, &http.Cookie{Name: "__cf_bm", Value: "bm", Path: "/"})
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `<html><body><form id="challenge-form" action="/?__cf_chl_f_tk=tok" method="POST">
+<div class="cf-turnstile" data-sitekey="0x4AAAAAAAtest" data-action="managed"></div></form></body></html>`)
+	}))
+	defer server.Close()
+
+	solver := &taskSolver{}
+	s, err := New(
+		WithCaptchaSolver(captcha.AsSolver(solver)),
+		WithSessionConfig(false, time.Hour, 0),
+		WithStealth(stealth.Options{Enabled: false}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := s.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	drainBody(resp)
+
+	task := solver.task
+	if task == nil {
+		t.Fatal("task solver was not called")
+	}
+	if task.Type != captcha.Turnstile || task.SiteKey != "0x4AAAAAAAtest" || task.Params.Action != "managed" {
+		t.Errorf("task = %+v", task)
+	}
+	if task.UserAgent == "" || task.UserAgent != s.UserAgent.Headers.Get("User-Agent") {
+		t.Errorf("task user agent = %q", task.UserAgent)
+	}
+	if len(task.Cookies) != 1 || task.Cookies[0].Name != "__cf_bm" {
+		t.Errorf("task cookies = %v", task.Cookies)
+	}
+	if task.Proxy != nil {
+		t.Errorf("task proxy = %v, want none", task.Proxy)
+	}
+	if submitted != "task-token" {
+		t.Errorf("submitted token = %q", submitted)
+	}
+}
+
+// reportingSolver returns its tokens in turn and records the reports it gets.
+type reportingSolver struct {
+	tokens []string
+	calls  int
+	bad    []string
+	good   []string
+}
+
+func (s *reportingSolver) SolveTask(task *captcha.Task) (*captcha.Result, error) {
+	token := s.tokens[s.calls%len(s.tokens)]
+	s.calls++
+	return &captcha.Result{Token: token, TaskID: fmt.Sprint(s.calls), Reporter: s}, nil
+}
+
+func (s *reportingSolver) ReportBad(result *captcha.Result) error {
+	s.bad = append(s.bad, result.TaskID)
+	return nil
+}
+
+func (s *reportingSolver) ReportGood(result *captcha.Result) error {
+	s.good = append(s.good, result.TaskID)
+	return nil
+}
+
+// TestSolveCaptchaChallenge_Reports asserts that a token answered by another
+// challenge is reported bad and one that reaches the page is reported good.
+func TestSolveCaptchaChallenge_Reports(t *testing.T) {
+	server := cftest.NewServer(cftest.Turnstile)
+	defer server.Close()
+
+	solver := &reportingSolver{tokens: []string{"wrong-token", cftest.DefaultTurnstileToken}}
+	s, err := New(
+		WithCaptchaSolver(captcha.AsSolver(solver)),
+		WithSessionConfig(false, time.Hour, 0),
+		WithStealth(stealth.Options{Enabled: false}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := s.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	drainBody(resp)
+
+	if len(solver.bad) != 1 || solver.bad[0] != "1" {
+		t.Errorf("reported bad = %v, want [1]", solver.bad)
+	}
+	if len(solver.good) != 1 || solver.good[0] != "2" {
+		t.Errorf("reported good = %v, want [2]", solver.good)
+	}
+}
+
+func TestSolveCaptchaChallenge_TwoCaptcha(t *testing.T) {
+	server := cftest.NewServer(cftest.Turnstile)
+	defer server.Close()
+	provider := captchatest.NewTwoCaptchaServer()
+	defer provider.Close()
+	provider.Token = cftest.DefaultTurnstileToken
+
+	s, err := New(
+		WithCaptchaSolver(provider.Solver()),
+		WithSessionConfig(false, time.Hour, 0),
+		WithStealth(stealth.Options{Enabled: false}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := s.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	drainBody(resp)
+
+	jobs := provider.Jobs()
+	if len(jobs) != 1 {
+		t.Fatalf("jobs = %+v, want one", jobs)
+	}
+	if j := jobs[0]; j.Form.Get("googlekey") != cftest.TurnstileSiteKey || j.Reported != "reportgood" {
+		t.Errorf("job = %+v", j)
+	}
+	if got := server.Stats(); got.Solved != 1 || got.Passed != 1 {
+		t.Errorf("stats = %+v", got)
+	}
+}
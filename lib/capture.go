@@ -0,0 +1,236 @@
+package cloudscraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultCaptureMaxFiles is the number of capture files kept in a capture
+	// directory when CaptureOptions.MaxFiles is zero.
+	DefaultCaptureMaxFiles = 100
+
+	captureFilePrefix = "challenge-"
+	// captureMaxBody caps the size of each body stored in a capture.
+	captureMaxBody = 2 << 20
+	redacted       = "[redacted]"
+)
+
+// CaptureOptions configures the recording of challenge pages for offline
+// debugging. Captures go to Dir, to Callback, or to both.
+type CaptureOptions struct {
+	// Dir receives one JSON file per challenge. It is created if needed.
+	Dir string
+	// MaxFiles is the number of capture files kept in Dir; older ones are
+	// removed. Zero means DefaultCaptureMaxFiles, a negative value keeps all.
+	MaxFiles int
+	// Callback is called with every capture.
+	Callback func(*ChallengeCapture)
+	// KeepCookies disables the redaction of cookie values.
+	KeepCookies bool
+}
+
+// ChallengeCapture records a challenge page and what the scraper did with it.
+type ChallengeCapture struct {
+	Time    time.Time     `json:"time"`
+	Kind    ChallengeKind `json:"kind"`
+	Handler string        `json:"handler"`
+	URL     string        `json:"url"`
+
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+	// Scripts holds the inline scripts of the page, in document order.
+	Scripts []string `json:"scripts,omitempty"`
+
+	Answer    string        `json:"answer,omitempty"`
+	Delay     time.Duration `json:"delay,omitempty"`
+	Waited    time.Duration `json:"waited,omitempty"`
+	SubmitURL string        `json:"submit_url,omitempty"`
+	Form      url.Values    `json:"form,omitempty"`
+
+	// FollowUp is the response the scraper returned after the submission.
+	FollowUp *CapturedResponse `json:"follow_up,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// CapturedResponse is a response stored in a ChallengeCapture.
+type CapturedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// challengeCapturer writes captures according to CaptureOptions.
+type challengeCapturer struct {
+	opts CaptureOptions
+	seq  atomic.Uint64
+	mu   sync.Mutex // serialises rotation
+}
+
+func newChallengeCapturer(opts *CaptureOptions) *challengeCapturer {
+	if opts == nil || (opts.Dir == "" && opts.Callback == nil) {
+		return nil
+	}
+	return &challengeCapturer{opts: *opts}
+}
+
+// captureChallenge records the challenge c handled by h, its outcome and the
+// response that followed it. Capture failures are logged, never returned.
+func (s *Scraper) captureChallenge(c *Challenge, h ChallengeHandler, result *http.Response, solveErr error) {
+	cc := s.capture
+	if cc == nil {
+		return
+	}
+
+	capture := &ChallengeCapture{
+		Time:       c.received,
+		Kind:       c.Kind,
+		Handler:    h.Name(),
+		URL:        c.URL().String(),
+		StatusCode: c.Response.StatusCode,
+		Header:     cc.redactHeader(c.Response.Header),
+		Body:       truncateCapture(c.Body),
+		Answer:     c.Result.Answer,
+		Delay:      c.Result.Delay,
+		Waited:     c.Result.Waited,
+		SubmitURL:  c.submitURL,
+		Form:       c.submitForm,
+	}
+	for _, script := range parseChallengePage(c.Body).Scripts {
+		capture.Scripts = append(capture.Scripts, script.Content)
+	}
+	if result != nil {
+		capture.FollowUp = cc.captureResponse(result)
+	}
+	if solveErr != nil {
+		capture.Error = solveErr.Error()
+	}
+
+	if cc.opts.Callback != nil {
+		cc.opts.Callback(capture)
+	}
+	if cc.opts.Dir != "" {
+		if err := cc.write(capture); err != nil {
+			s.logger.Printf("Warning: failed to write challenge capture: %v\n", err)
+		}
+	}
+}
+
+// captureResponse snapshots resp, leaving its body readable for the caller.
+func (cc *challengeCapturer) captureResponse(resp *http.Response) *CapturedResponse {
+	captured := &CapturedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     cc.redactHeader(resp.Header),
+	}
+	if resp.Body != nil {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(strings.NewReader(string(body)))
+		if err == nil {
+			captured.Body = truncateCapture(string(body))
+		}
+	}
+	return captured
+}
+
+// redactHeader copies h, replacing cookie values with a placeholder but keeping
+// the cookie names and attributes.
+func (cc *challengeCapturer) redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	if cc.opts.KeepCookies {
+		return out
+	}
+	for _, key := range []string{"Set-Cookie", "Cookie"} {
+		for i, v := range out[key] {
+			out[key][i] = redactCookies(v)
+		}
+	}
+	return out
+}
+
+// redactCookies replaces the value of every name=value pair in a Cookie or
+// Set-Cookie header value. Set-Cookie attributes other than the first pair are
+// kept, as they carry no secret.
+func redactCookies(v string) string {
+	parts := strings.Split(v, ";")
+	for i, part := range parts {
+		name, _, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "path", "domain", "expires", "max-age", "samesite":
+			if i > 0 {
+				continue
+			}
+		}
+		parts[i] = name + "=" + redacted
+	}
+	return strings.Join(parts, ";")
+}
+
+func truncateCapture(body string) string {
+	if len(body) > captureMaxBody {
+		return body[:captureMaxBody]
+	}
+	return body
+}
+
+// write stores capture as a JSON file in the capture directory and removes the
+// oldest files beyond MaxFiles.
+func (cc *challengeCapturer) write(capture *ChallengeCapture) error {
+	if err := os.MkdirAll(cc.opts.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(capture, "", "  ")
+	if err != nil {
+		return err
+	}
+	kind := string(capture.Kind)
+	if kind == "" {
+		kind = capture.Handler
+	}
+	name := fmt.Sprintf("%s%s-%06d-%s.json", captureFilePrefix,
+		capture.Time.UTC().Format("20060102T150405.000000000"), cc.seq.Add(1), kind)
+	if err := os.WriteFile(filepath.Join(cc.opts.Dir, name), data, 0o600); err != nil {
+		return err
+	}
+	return cc.rotate()
+}
+
+func (cc *challengeCapturer) rotate() error {
+	max := cc.opts.MaxFiles
+	if max == 0 {
+		max = DefaultCaptureMaxFiles
+	}
+	if max < 0 {
+		return nil
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	files, err := filepath.Glob(filepath.Join(cc.opts.Dir, captureFilePrefix+"*.json"))
+	if err != nil {
+		return err
+	}
+	// Names start with the timestamp and sequence, so they sort oldest first.
+	sort.Strings(files)
+	for len(files) > max {
+		if err := os.Remove(files[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
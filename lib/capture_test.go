@@ -0,0 +1,113 @@
+package cloudscraper
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/stealth"
+)
+
+func TestChallengeCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			_ = r.ParseForm()
+			if r.PostForm.Get("jschl_answer") == "42" {
+				_, _ = io.WriteString(w, "welcome")
+				return
+			}
+		}
+		w.Header().Set("Server", "cloudflare")
+		w.Header().Add("Set-Cookie", "__cf_bm=secret-value; Path=/; HttpOnly")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `<html><body>
+<form id="challenge-form" action="/submit" method="POST"></form>
+<script>
+	window._cf_chl_opt = {cvId: '3'};
+	document.getElementById('jschl-answer').value = '42';
+</script></body></html>`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var captures []*ChallengeCapture
+	s, err := New(
+		WithStealth(stealth.Options{Enabled: false}),
+		WithSessionConfig(false, time.Hour, 0),
+		WithChallengeDelay(0),
+		WithChallengeCapture(CaptureOptions{
+			Dir:      dir,
+			MaxFiles: 2,
+			Callback: func(c *ChallengeCapture) {
+				mu.Lock()
+				captures = append(captures, c)
+				mu.Unlock()
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := s.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "welcome" {
+			t.Fatalf("body = %q, the capture must leave the response readable", body)
+		}
+	}
+
+	if len(captures) != 3 {
+		t.Fatalf("got %d captures, want 3", len(captures))
+	}
+	c := captures[0]
+	if c.Kind != KindJSV2 || c.Handler != HandlerJSV2 || c.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected capture metadata: %+v", c)
+	}
+	if c.Answer != "42" || c.Form.Get("jschl_answer") != "42" || !strings.HasSuffix(c.SubmitURL, "/submit") {
+		t.Errorf("answer %q, form %v, submit URL %q", c.Answer, c.Form, c.SubmitURL)
+	}
+	if len(c.Scripts) != 1 || !strings.Contains(c.Scripts[0], "_cf_chl_opt") {
+		t.Errorf("scripts = %q", c.Scripts)
+	}
+	if c.FollowUp == nil || c.FollowUp.StatusCode != http.StatusOK || c.FollowUp.Body != "welcome" {
+		t.Errorf("follow-up = %+v", c.FollowUp)
+	}
+	if got := c.Header.Get("Set-Cookie"); got != "__cf_bm=[redacted]; Path=/; HttpOnly" {
+		t.Errorf("Set-Cookie = %q, want the value redacted", got)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "challenge-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d capture files, want 2 after rotation", len(files))
+	}
+	data, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-value") {
+		t.Error("capture file contains a cookie value")
+	}
+	var stored ChallengeCapture
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("capture file is not valid JSON: %v", err)
+	}
+	if stored.Answer != "42" {
+		t.Errorf("stored answer = %q", stored.Answer)
+	}
+}
@@ -0,0 +1,128 @@
+package cftest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// jsDigit returns a JSFuck-style expression evaluating to the number d (0-9).
+func jsDigit(d int) string {
+	switch d {
+	case 0:
+		return "+[]"
+	case 1:
+		return "+!![]"
+	}
+	return "!+[]" + strings.Repeat("+!![]", d-1)
+}
+
+// v1Expression returns an obfuscated jschl expression and the answer it yields
+// for host, computed the way the classic challenge does: the two-digit number
+// the expression spells, plus the length of the host name.
+func v1Expression(host string) (expr, answer string) {
+	tens, ones := 1+rand.Intn(9), rand.Intn(10)
+	expr = fmt.Sprintf("+((%s+[])+(%s))", jsDigit(tens), jsDigit(ones))
+	value := tens*10 + ones + len(host)
+	return expr, fmt.Sprintf("%.10f", float64(value))
+}
+
+func v1Page(token, expr string, delay time.Duration) string {
+	return `<!DOCTYPE HTML>
+<html lang="en-US">
+<head>
+  <meta charset="UTF-8" />
+  <title>Just a moment...</title>
+  <script type="text/javascript">
+  //<![CDATA[
+  (function(){
+    var a = function() {try{return !!window.addEventListener} catch(e) {return !1} },
+    b = function(b, c) {a() ? document.addEventListener("DOMContentLoaded", b, c) : document.attachEvent("onreadystatechange", b)};
+    b(function(){
+      setTimeout(function(){
+        var s,t,o,p,b,r,e,a,k,i,n,g,f; t = document.createElement('div'); t.innerHTML="<a href='/'>x</a>"; t = t.firstChild.href;r = t.match(/https?:\/\//)[0]; t = t.substr(r.length); t = t.substr(0,t.length-1); a = document.getElementById('jschl-answer'); f = document.getElementById('challenge-form'); a.value = (` + expr + ` + t.length).toFixed(10); '; 121'
+        f.action += location.hash;
+        f.submit();
+      }, ` + fmt.Sprint(delay.Milliseconds()) + `);
+    }, false);
+  })();
+  //]]>
+  </script>
+</head>
+<body>
+  <div id="cf-content"><h1>Checking your browser before accessing the site.</h1></div>
+  <form id="challenge-form" action="` + v1SubmitPath + `?__cf_chl_jschl_tk__=` + token + `" method="POST">
+    <input type="hidden" name="r" value="` + randomHex(20) + `"/>
+    <input type="hidden" name="jschl_vc" value="` + randomHex(16) + `"/>
+    <input type="hidden" name="pass" value="` + fmt.Sprintf("%d.%03d-%s", time.Now().Unix(), rand.Intn(1000), randomHex(6)) + `"/>
+    <input type="hidden" id="jschl-answer" name="jschl_answer"/>
+  </form>
+  <script src="/cdn-cgi/images/trace/jsch/js/transparent.gif" style="display:none"></script>
+</body>
+</html>`
+}
+
+// v2Operands returns the two factors a v2 page multiplies and their product.
+func v2Operands() (a, b int, answer string) {
+	a, b = 2+rand.Intn(98), 2+rand.Intn(98)
+	return a, b, fmt.Sprint(a * b)
+}
+
+// v2Page renders a modern challenge. It has no form: the solver posts the
+// answer to the orchestrate endpoint, and the challenge is identified by the
+// r parameter of __CF$cv$params.
+func v2Page(token string, a, b int, delay time.Duration) string {
+	ray := randomHex(8)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en-US">
+<head><title>Just a moment...</title></head>
+<body>
+  <h2 id="challenge-running">Checking if the site connection is secure</h2>
+  <script>
+    (function(){
+      window._cf_chl_opt = {cvId: '2', cType: 'non-interactive', cNounce: '%d', cRay: '%s', cHash: '%s'};
+      window.__CF$cv$params = {r: '%s', t: '%s'};
+      setTimeout(function() {
+        document.getElementById('jschl-answer').value = String(%d * %d);
+      }, %d);
+    }());
+  </script>
+  <script src="/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1?ray=%s"></script>
+</body>
+</html>`, rand.Intn(100000), ray, randomHex(8), token, randomHex(8), a, b, delay.Milliseconds(), ray)
+}
+
+// turnstilePage renders a managed challenge with a Turnstile widget. The form is
+// built by script in the real page; here its action and hidden field are only
+// available from _cf_chl_opt.
+func turnstilePage(token, path string) string {
+	ray := randomHex(8)
+	path, _, _ = strings.Cut(path, "?")
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en-US">
+<head>
+  <title>Just a moment...</title>
+  <script src="https://challenges.cloudflare.com/turnstile/v0/api.js" async defer></script>
+</head>
+<body>
+  <h2 id="challenge-running">Verify you are human by completing the action below.</h2>
+  <div class="cf-turnstile" data-sitekey="%s" data-action="managed" data-cdata="%s"></div>
+  <script>(function(){window._cf_chl_opt={cvId: '3', cType: 'managed', cRay: '%s', fa: "%s?__cf_chl_f_tk=%s", md: "%s"};}());</script>
+</body>
+</html>`, TurnstileSiteKey, ray, ray, path, token, randomHex(12))
+}
+
+func blockPage(code int, title string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en-US">
+<head><title>%s | Cloudflare</title></head>
+<body>
+  <div id="cf-wrapper">
+    <h1><span data-translate="error">Error</span> <span class="cf-error-code">%d</span></h1>
+    <h2>%s</h2>
+    <p>Ray ID: %s</p>
+  </div>
+</body>
+</html>`, title, code, title, randomHex(8))
+}
@@ -0,0 +1,327 @@
+// Package cftest provides a local HTTP server that emulates Cloudflare's
+// challenge behaviour, so that the full scraper flow can be tested offline.
+//
+// A Server protects every path with a Behaviour, chosen per path prefix. Solved
+// challenges earn a cf_clearance cookie that is bound to the User-Agent and IP
+// address that solved them, as on Cloudflare.
+package cftest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Behaviour is what the server does with requests that carry no valid clearance.
+type Behaviour int
+
+const (
+	// Pass serves the origin without any challenge.
+	Pass Behaviour = iota
+	// JSV1 serves a classic jschl arithmetic challenge.
+	JSV1
+	// JSV2 serves a modern _cf_chl_opt challenge whose answer is posted to the
+	// orchestrate endpoint.
+	JSV2
+	// Turnstile serves a managed challenge with a Turnstile widget.
+	Turnstile
+	// Loop403 serves a fresh JS challenge on every request and never grants
+	// clearance, even to correct answers.
+	Loop403
+	// Block1020 serves the firewall "Access denied" page (error 1020).
+	Block1020
+	// RateLimit429 serves the rate-limit page (error 1015) with status 429.
+	RateLimit429
+)
+
+func (b Behaviour) String() string {
+	switch b {
+	case Pass:
+		return "pass"
+	case JSV1:
+		return "js-v1"
+	case JSV2:
+		return "js-v2"
+	case Turnstile:
+		return "turnstile"
+	case Loop403:
+		return "loop-403"
+	case Block1020:
+		return "block-1020"
+	case RateLimit429:
+		return "rate-limit-429"
+	}
+	return fmt.Sprintf("Behaviour(%d)", int(b))
+}
+
+const (
+	// ClearanceCookie is the name of the cookie granted for a solved challenge.
+	ClearanceCookie = "cf_clearance"
+	// DefaultTurnstileToken is the Turnstile response the server accepts by default.
+	DefaultTurnstileToken = "cftest-turnstile-token"
+	// TurnstileSiteKey is the site key of the Turnstile widget the server embeds.
+	TurnstileSiteKey = "0x4AAAAAAAcftestSiteKey"
+	// DefaultChallengeDelay is the delay challenge pages ask for by default.
+	DefaultChallengeDelay = 4 * time.Second
+
+	v1SubmitPath = "/cdn-cgi/l/chk_jschl"
+	v2SubmitPath = "/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1"
+)
+
+// Stats counts what the server did.
+type Stats struct {
+	// Challenges is the number of challenge pages served.
+	Challenges int
+	// Solved is the number of accepted answers.
+	Solved int
+	// Rejected is the number of wrong, stale or early answers.
+	Rejected int
+	// ClearanceMismatches counts clearance cookies presented with another
+	// User-Agent or from another IP than the ones that earned them.
+	ClearanceMismatches int
+	// Blocked is the number of block and rate-limit pages served.
+	Blocked int
+	// Passed is the number of requests served by the origin.
+	Passed int
+}
+
+// Server is a mock Cloudflare edge in front of an origin handler.
+type Server struct {
+	*httptest.Server
+
+	// Origin serves requests that pass. It defaults to a handler writing
+	// "origin: <path>".
+	Origin http.Handler
+	// ChallengeDelay is the setTimeout delay challenge pages ask for.
+	ChallengeDelay time.Duration
+	// EnforceDelay rejects answers submitted before ChallengeDelay has passed.
+	EnforceDelay bool
+	// TurnstileToken is the Turnstile response accepted for Turnstile pages.
+	TurnstileToken string
+
+	mu         sync.Mutex
+	fallback   Behaviour
+	routes     map[string]Behaviour
+	pending    map[string]*challenge
+	clearances map[string]visitor
+	stats      Stats
+}
+
+// challenge is an issued challenge awaiting its answer.
+type challenge struct {
+	behaviour Behaviour
+	path      string
+	answer    string
+	issued    time.Time
+}
+
+// visitor identifies who earned a clearance.
+type visitor struct {
+	userAgent string
+	ip        string
+}
+
+// NewServer starts a server that applies fallback to every path without a
+// more specific Route. Close it when done.
+func NewServer(fallback Behaviour) *Server {
+	s := &Server{
+		Origin:         http.HandlerFunc(originHandler),
+		ChallengeDelay: DefaultChallengeDelay,
+		TurnstileToken: DefaultTurnstileToken,
+		fallback:       fallback,
+		routes:         make(map[string]Behaviour),
+		pending:        make(map[string]*challenge),
+		clearances:     make(map[string]visitor),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Route sets the behaviour for paths starting with prefix. The longest matching
+// prefix wins.
+func (s *Server) Route(prefix string, b Behaviour) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes[prefix] = b
+}
+
+// Stats returns a snapshot of the server counters.
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// behaviour returns the behaviour for path. Callers must hold mu.
+func (s *Server) behaviour(path string) Behaviour {
+	best, b := -1, s.fallback
+	for prefix, rb := range s.routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > best {
+			best, b = len(prefix), rb
+		}
+	}
+	return b
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "cloudflare")
+	w.Header().Set("CF-RAY", randomHex(8)+"-LHR")
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == v1SubmitPath:
+		s.verify(w, r, r.URL.Query().Get("__cf_chl_jschl_tk__"), "jschl_answer")
+		return
+	case r.Method == http.MethodPost && r.URL.Path == v2SubmitPath:
+		_ = r.ParseForm()
+		s.verify(w, r, r.PostForm.Get("r"), "jschl_answer")
+		return
+	case r.Method == http.MethodPost && r.URL.Query().Get("__cf_chl_f_tk") != "":
+		s.verify(w, r, r.URL.Query().Get("__cf_chl_f_tk"), "cf-turnstile-response")
+		return
+	}
+
+	s.mu.Lock()
+	b := s.behaviour(r.URL.Path)
+	cleared := b == Pass || s.cleared(r)
+	if cleared {
+		s.stats.Passed++
+	}
+	origin := s.Origin
+	s.mu.Unlock()
+
+	if cleared {
+		origin.ServeHTTP(w, r)
+		return
+	}
+	s.challenge(w, r, b, r.URL.RequestURI())
+}
+
+// cleared reports whether r carries a clearance earned by the same visitor.
+// Callers must hold mu.
+func (s *Server) cleared(r *http.Request) bool {
+	cookie, err := r.Cookie(ClearanceCookie)
+	if err != nil {
+		return false
+	}
+	v, ok := s.clearances[cookie.Value]
+	if !ok {
+		return false
+	}
+	if v != visitorOf(r) {
+		s.stats.ClearanceMismatches++
+		return false
+	}
+	return true
+}
+
+// challenge serves the page for b and records the challenge it issues. Once the
+// challenge is solved the visitor is redirected to path.
+func (s *Server) challenge(w http.ResponseWriter, r *http.Request, b Behaviour, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch b {
+	case Block1020:
+		s.stats.Blocked++
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, blockPage(1020, "Access denied"))
+		return
+	case RateLimit429:
+		s.stats.Blocked++
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, blockPage(1015, "You are being rate limited"))
+		return
+	}
+
+	s.stats.Challenges++
+	token := randomHex(16)
+	c := &challenge{behaviour: b, path: path, issued: time.Now()}
+	s.pending[token] = c
+
+	var page string
+	status := http.StatusServiceUnavailable
+	switch b {
+	case JSV1:
+		var expr string
+		expr, c.answer = v1Expression(r.Host)
+		page = v1Page(token, expr, s.ChallengeDelay)
+	case Turnstile:
+		status = http.StatusForbidden
+		w.Header().Set("cf-mitigated", "challenge")
+		c.answer = s.TurnstileToken
+		page = turnstilePage(token, path)
+	default: // JSV2, Loop403
+		if b == Loop403 {
+			status = http.StatusForbidden
+		}
+		var a, bb int
+		a, bb, c.answer = v2Operands()
+		page = v2Page(token, a, bb, s.ChallengeDelay)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(status)
+	io.WriteString(w, page)
+}
+
+// verify checks the answer to the challenge identified by token. A correct
+// answer earns a clearance cookie and a redirect to the challenged page;
+// anything else gets a new challenge.
+func (s *Server) verify(w http.ResponseWriter, r *http.Request, token, field string) {
+	_ = r.ParseForm()
+
+	s.mu.Lock()
+	c, ok := s.pending[token]
+	delete(s.pending, token)
+	accepted := ok && r.PostForm.Get(field) == c.answer &&
+		(!s.EnforceDelay || time.Since(c.issued) >= s.ChallengeDelay)
+	if !accepted {
+		s.stats.Rejected++
+		b, path := s.fallback, "/"
+		if ok {
+			b, path = c.behaviour, c.path
+		}
+		s.mu.Unlock()
+		s.challenge(w, r, b, path)
+		return
+	}
+	s.stats.Solved++
+	if c.behaviour != Loop403 {
+		clearance := randomHex(24)
+		s.clearances[clearance] = visitorOf(r)
+		http.SetCookie(w, &http.Cookie{Name: ClearanceCookie, Value: clearance, Path: "/", HttpOnly: true})
+	}
+	s.mu.Unlock()
+
+	http.Redirect(w, r, c.path, http.StatusFound)
+}
+
+func visitorOf(r *http.Request) visitor {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return visitor{userAgent: r.UserAgent(), ip: ip}
+}
+
+func originHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "origin: %s", r.URL.Path)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,147 @@
+package cftest_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	cloudscraper "github.com/Advik-B/cloudscraper/lib"
+	"github.com/Advik-B/cloudscraper/lib/cftest"
+	cserrors "github.com/Advik-B/cloudscraper/lib/errors"
+	"github.com/Advik-B/cloudscraper/lib/stealth"
+)
+
+// tokenSolver answers every captcha with a fixed token.
+type tokenSolver string
+
+func (s tokenSolver) Solve(captchaType, url, siteKey string) (string, error) {
+	return string(s), nil
+}
+
+func newScraper(t *testing.T, opts ...cloudscraper.ScraperOption) *cloudscraper.Scraper {
+	t.Helper()
+	opts = append([]cloudscraper.ScraperOption{
+		cloudscraper.WithStealth(stealth.Options{Enabled: false}),
+		cloudscraper.WithSessionConfig(false, time.Hour, 0),
+		cloudscraper.WithChallengeDelay(0),
+	}, opts...)
+	s, err := cloudscraper.New(opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+func get(t *testing.T, s *cloudscraper.Scraper, url string) (string, error) {
+	t.Helper()
+	resp, err := s.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body %q", resp.StatusCode, body)
+	}
+	return string(body), nil
+}
+
+func TestServer_SolvableChallenges(t *testing.T) {
+	tests := []struct {
+		name      string
+		behaviour cftest.Behaviour
+	}{
+		{"v1", cftest.JSV1},
+		{"v2", cftest.JSV2},
+		{"turnstile", cftest.Turnstile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := cftest.NewServer(tt.behaviour)
+			defer server.Close()
+			s := newScraper(t, cloudscraper.WithCaptchaSolver(tokenSolver(cftest.DefaultTurnstileToken)))
+
+			body, err := get(t, s, server.URL+"/protected?page=1")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if body != "origin: /protected" {
+				t.Errorf("body = %q", body)
+			}
+
+			// The clearance cookie lets the next request through unchallenged.
+			if _, err := get(t, s, server.URL+"/other"); err != nil {
+				t.Fatalf("second Get: %v", err)
+			}
+			stats := server.Stats()
+			if stats.Challenges != 1 || stats.Solved != 1 || stats.Rejected != 0 || stats.Passed != 2 {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestServer_ClearanceBoundToUserAgent(t *testing.T) {
+	server := cftest.NewServer(cftest.JSV2)
+	defer server.Close()
+	s := newScraper(t)
+
+	if _, err := get(t, s, server.URL+"/"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	// A new session rotates the User-Agent, which invalidates the clearance.
+	s.UserAgent.Headers.Set("User-Agent", "cftest-other-agent")
+	if _, err := get(t, s, server.URL+"/"); err != nil {
+		t.Fatalf("Get after UA change: %v", err)
+	}
+	stats := server.Stats()
+	if stats.ClearanceMismatches != 1 || stats.Challenges != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestServer_RejectsEarlyAnswers(t *testing.T) {
+	server := cftest.NewServer(cftest.JSV2)
+	defer server.Close()
+	server.ChallengeDelay = 200 * time.Millisecond
+	server.EnforceDelay = true
+
+	if _, err := newScraper(t).Get(server.URL + "/"); !errors.Is(err, cserrors.ErrChallengeLoop) {
+		t.Fatalf("error = %v, want ErrChallengeLoop for answers submitted too early", err)
+	}
+
+	s := newScraper(t, cloudscraper.WithChallengeDelay(cloudscraper.ServerChallengeDelay))
+	if _, err := get(t, s, server.URL+"/"); err != nil {
+		t.Fatalf("Get honouring the delay: %v", err)
+	}
+}
+
+func TestServer_RoutesAndFailures(t *testing.T) {
+	server := cftest.NewServer(cftest.Pass)
+	defer server.Close()
+	server.Route("/loop", cftest.Loop403)
+	server.Route("/blocked", cftest.Block1020)
+	server.Route("/busy", cftest.RateLimit429)
+	server.Route("/blocked/open", cftest.Pass)
+	s := newScraper(t)
+
+	if _, err := get(t, s, server.URL+"/blocked/open/page"); err != nil {
+		t.Errorf("longest prefix should pass: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/loop", cserrors.ErrChallengeLoop},
+		{"/blocked", cserrors.ErrAccessDenied},
+		{"/busy", cserrors.ErrRateLimited},
+	}
+	for _, tt := range tests {
+		if _, err := s.Get(server.URL + tt.path); !errors.Is(err, tt.want) {
+			t.Errorf("Get(%s) error = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+}
@@ -1,14 +1,16 @@
 package cloudscraper
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/Advik-B/cloudscraper/lib/captcha"
 	"github.com/Advik-B/cloudscraper/lib/errors"
 )
 
@@ -21,96 +23,160 @@ const (
 var (
 	jsV1DetectRegex    = regexp.MustCompile(`(?i)cdn-cgi/images/trace/jsch/`)
 	jsV2DetectRegex    = regexp.MustCompile(`(?i)/cdn-cgi/challenge-platform/`)
-	captchaDetectRegex = regexp.MustCompile(`data-sitekey="([^\"]+)"`)
-	challengeFormRegex = regexp.MustCompile(`<form class="challenge-form" id="challenge-form" action="(.+?)" method="POST">`)
-	jschlVcRegex       = regexp.MustCompile(`name="jschl_vc" value="(\w+)"`)
-	passRegex          = regexp.MustCompile(`name="pass" value="(.+?)"`)
-	rValueOldRegex     = regexp.MustCompile(`name="r" value="([^"]+)"`)
-	rValueModernRegex  = regexp.MustCompile(`r:\s*'([^']+)'`)
+	captchaDetectRegex = regexp.MustCompile(`data-sitekey\s*=\s*["']([^"']+)["']`)
+	rValueModernRegex  = regexp.MustCompile(`\br\s*:\s*(?:'([^']+)'|"([^"]+)")`)
 )
 
-// allowRefresh is threaded through the challenge-solving chain so that a form
-// submission fired from inside refreshSession's probe (allowRefresh=false)
-// cannot re-enter the singleflight group that probe is already holding.
-// User-initiated requests pass allowRefresh=true and keep the original
-// auto-refresh-on-403 behavior.
-func (s *Scraper) handleChallenge(resp *http.Response, allowRefresh bool) (*http.Response, error) {
+// handleChallenge solves a challenge detected by h. resp's body has already been
+// read into body by doWithRefresh; ctx is the context of the challenged request
+// and proxy the proxy it was sent through, if any.
+func (s *Scraper) handleChallenge(ctx context.Context, h ChallengeHandler, resp *http.Response, body string, proxy *url.URL, allowRefresh bool) (*http.Response, error) {
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+
+	kind := ClassifyChallenge(resp, body)
+	if kind.Blocked() {
+		s.logger.Printf("Cloudflare block page detected (%s), not retrying\n", kind)
+	} else {
+		s.logger.Printf("Cloudflare protection detected (%s), attempting to bypass...\n", h.Name())
+	}
+	ctx, chain := withChallengeChain(ctx)
+	c := &Challenge{
+		Scraper:      s,
+		Response:     resp,
+		Body:         body,
+		Kind:         kind,
+		ctx:          ctx,
+		chain:        chain,
+		proxy:        proxy,
+		received:     time.Now(),
+		allowRefresh: allowRefresh,
+	}
+	var result *http.Response
+	err := chain.add(challengeAttempt(c), s.opts.MaxChallengeAttempts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read challenge response body: %w", err)
+		s.logger.Printf("Not attempting challenge: %v\n", err)
+	} else {
+		result, err = h.Solve(c)
 	}
-	bodyStr := string(body)
-
-	// Check for modern v2/v3 JS VM challenge first
-	if jsV2DetectRegex.MatchString(bodyStr) {
-		s.logger.Printf("Modern (v2/v3) JavaScript challenge detected. Solving with '%s'...\n", s.opts.JSRuntime)
-		return s.solveModernJSChallenge(resp, bodyStr, allowRefresh)
+	s.captureChallenge(c, h, result, err)
+	if err != nil {
+		return nil, s.challengeError(c, h, err)
 	}
+	return result, nil
+}
 
-	// Check for classic lib JS challenge
-	if jsV1DetectRegex.MatchString(bodyStr) {
-		s.logger.Printf("Classic (v1) JavaScript challenge detected. Solving with '%s'...\n", s.opts.JSRuntime)
-		return s.solveClassicJSChallenge(resp.Request.URL, bodyStr, allowRefresh)
+// challengeError wraps err in an errors.ChallengeError describing the page c.
+// An error that already is a ChallengeError, raised by a follow-up challenge
+// further down the chain, is returned unchanged as it is the more specific one.
+func (s *Scraper) challengeError(c *Challenge, h ChallengeHandler, err error) error {
+	var ce *errors.ChallengeError
+	if stderrors.As(err, &ce) {
+		return err
 	}
 
-	// Check for Captcha/Turnstile
-	if siteKeyMatch := captchaDetectRegex.FindStringSubmatch(bodyStr); len(siteKeyMatch) > 1 {
-		s.logger.Println("Captcha/Turnstile challenge detected...")
-		return s.solveCaptchaChallenge(resp, bodyStr, siteKeyMatch[1], allowRefresh)
+	opt := parseChlOpt(c.Body)
+	history := []errors.ChallengeAttempt{challengeAttempt(c)}
+	if c.chain != nil {
+		history = c.chain.history()
+	}
+	kind := c.Kind
+	if kind == KindNone {
+		kind = ChallengeKind(h.Name())
+	}
+	return &errors.ChallengeError{
+		Kind:       string(kind),
+		RayID:      c.Response.Header.Get("cf-ray"),
+		StatusCode: c.Response.StatusCode,
+		URL:        c.URL().String(),
+		CType:      opt["cType"],
+		CRay:       opt["cRay"],
+		CZone:      opt["cZone"],
+		Attempts:   len(history),
+		History:    history,
+		Solver:     s.solverName(c, h, kind),
+		Err:        err,
 	}
+}
 
-	return nil, errors.ErrUnknownChallenge
+// solverName describes the handler and the engine or captcha provider it relies on.
+func (s *Scraper) solverName(c *Challenge, h ChallengeHandler, kind ChallengeKind) string {
+	switch {
+	case kind.Blocked():
+		return h.Name()
+	case kind == KindCaptcha || (kind == KindManaged && captchaDetectRegex.MatchString(c.Body)):
+		if s.CaptchaSolver == nil {
+			return h.Name()
+		}
+		return fmt.Sprintf("%s/%T", h.Name(), s.CaptchaSolver)
+	case s.opts.CustomJSEngine != nil:
+		return fmt.Sprintf("%s/%T", h.Name(), s.opts.CustomJSEngine)
+	case s.opts.JSRuntime != "":
+		return h.Name() + "/" + string(s.opts.JSRuntime)
+	}
+	return h.Name()
 }
 
-func (s *Scraper) solveClassicJSChallenge(originalURL *url.URL, body string, allowRefresh bool) (*http.Response, error) {
-	time.Sleep(4 * time.Second)
+func (s *Scraper) solveClassicJSChallenge(c *Challenge) (*http.Response, error) {
+	s.logger.Printf("Classic (v1) JavaScript challenge detected. Solving with '%s'...\n", s.opts.JSRuntime)
+	originalURL, body := c.URL(), c.Body
+	page := parseChallengePage(body)
 
 	answer, err := solveV1Logic(body, originalURL.Host, s.jsEngine)
 	if err != nil {
 		return nil, fmt.Errorf("v1 challenge solver failed: %w", err)
 	}
+	c.Result.Answer = answer
 
-	formMatch := challengeFormRegex.FindStringSubmatch(body)
-	if len(formMatch) < 2 {
+	form := page.challengeForm()
+	if form == nil || form.Action == "" {
 		return nil, fmt.Errorf("v1: could not find challenge form")
 	}
-	vcMatch := jschlVcRegex.FindStringSubmatch(body)
-	if len(vcMatch) < 2 {
+	if !form.Fields.Has("jschl_vc") {
 		return nil, fmt.Errorf("v1: could not find jschl_vc")
 	}
-	passMatch := passRegex.FindStringSubmatch(body)
-	if len(passMatch) < 2 {
+	if !form.Fields.Has("pass") {
 		return nil, fmt.Errorf("v1: could not find pass")
 	}
 
-	fullSubmitURL, _ := originalURL.Parse(formMatch[1])
+	fullSubmitURL, err := originalURL.Parse(form.Action)
+	if err != nil {
+		return nil, fmt.Errorf("v1: invalid form action URL: %w", err)
+	}
 	formData := url.Values{
-		"r":            {s.extractRValue(body)},
-		"jschl_vc":     {vcMatch[1]},
-		"pass":         {passMatch[1]},
+		"r":            {s.extractRValue(page)},
+		"jschl_vc":     {form.Fields.Get("jschl_vc")},
+		"pass":         {form.Fields.Get("pass")},
 		"jschl_answer": {answer},
 	}
 
-	return s.submitChallengeForm(fullSubmitURL.String(), originalURL.String(), formData, allowRefresh)
+	if err := s.waitChallengeDelay(c, page); err != nil {
+		return nil, err
+	}
+	return c.Submit(fullSubmitURL.String(), formData)
 }
 
-func (s *Scraper) solveModernJSChallenge(resp *http.Response, body string, allowRefresh bool) (*http.Response, error) {
-	answer, err := solveV2Logic(body, resp.Request.URL.Host, s.jsEngine, s.logger)
+func (s *Scraper) solveModernJSChallenge(c *Challenge) (*http.Response, error) {
+	s.logger.Printf("Modern (v2/v3) JavaScript challenge detected. Solving with '%s'...\n", s.opts.JSRuntime)
+	resp, body := c.Response, c.Body
+	res, err := solveV2Logic(body, resp.Request.URL.Host, s.jsEngine, s.logger)
 	if err != nil {
+		logDiagnostics(s.logger, res)
 		return nil, fmt.Errorf("v2 challenge solver failed: %w", err)
 	}
+	answer := res.Value
+	c.Result.Answer = answer
 
 	// Try to find the challenge form (old style)
-	formMatch := challengeFormRegex.FindStringSubmatch(body)
+	page := parseChallengePage(body)
+	form := page.challengeForm()
 	var submitURL string
-	
-	if len(formMatch) >= 2 {
+
+	if form != nil && form.Action != "" {
 		// Old style: form exists in HTML
-		fullSubmitURL, err := resp.Request.URL.Parse(formMatch[1])
+		fullSubmitURL, err := resp.Request.URL.Parse(form.Action)
 		if err != nil {
 			// Log the error but continue - we'll try the fallback URL construction
-			s.logger.Printf("Warning: failed to parse form action URL %q: %v", formMatch[1], err)
+			s.logger.Printf("Warning: failed to parse form action URL %q: %v", form.Action, err)
 			submitURL = s.buildModernSubmitURL(resp.Request.URL)
 		} else {
 			submitURL = fullSubmitURL.String()
@@ -120,83 +186,158 @@ func (s *Scraper) solveModernJSChallenge(resp *http.Response, body string, allow
 		// Use the standard modern challenge submission URL pattern
 		submitURL = s.buildModernSubmitURL(resp.Request.URL)
 	}
-	
+
 	// Extract optional fields that may not be present in modern challenges
 	var jschlVc, pass string
-	
-	vcMatch := jschlVcRegex.FindStringSubmatch(body)
-	if len(vcMatch) >= 2 {
-		jschlVc = vcMatch[1]
-	}
-	
-	passMatch := passRegex.FindStringSubmatch(body)
-	if len(passMatch) >= 2 {
-		pass = passMatch[1]
+	if form != nil {
+		jschlVc = form.Fields.Get("jschl_vc")
+		pass = form.Fields.Get("pass")
 	}
 
 	formData := url.Values{
-		"r":            {s.extractRValue(body)},
+		"r":            {s.extractRValue(page)},
 		"jschl_vc":     {jschlVc},
 		"pass":         {pass},
 		"jschl_answer": {answer},
 	}
 
-	return s.submitChallengeForm(submitURL, resp.Request.URL.String(), formData, allowRefresh)
+	if err := s.waitChallengeDelay(c, page); err != nil {
+		return nil, err
+	}
+	return c.Submit(submitURL, formData)
 }
 
-func (s *Scraper) solveCaptchaChallenge(resp *http.Response, body, siteKey string, allowRefresh bool) (*http.Response, error) {
+func (s *Scraper) solveCaptchaChallenge(c *Challenge) (*http.Response, error) {
+	s.logger.Println("Captcha/Turnstile challenge detected...")
 	if s.CaptchaSolver == nil {
 		return nil, errors.ErrNoCaptchaSolver
 	}
+	resp, body := c.Response, c.Body
 
-	token, err := s.CaptchaSolver.Solve("turnstile", resp.Request.URL.String(), siteKey)
+	page := parseChallengePage(body)
+	widget, err := parseCaptchaPage(page, body)
 	if err != nil {
-		return nil, fmt.Errorf("captcha solver failed: %w", err)
+		return nil, err
 	}
+	s.logger.Printf("Captcha widget: %s (site key %s)\n", widget.Widget, widget.SiteKey)
 
-	// Note: Captcha challenges currently require a form element in the HTML.
-	// If modern captcha challenges also use dynamic forms, this will need the same
-	// flexible detection logic as solveModernJSChallenge (see issue #2 fix).
-	formMatch := challengeFormRegex.FindStringSubmatch(body)
-	if len(formMatch) < 2 {
-		return nil, fmt.Errorf("captcha: could not find challenge form")
+	task := &captcha.Task{
+		Type:      string(widget.Widget),
+		PageURL:   resp.Request.URL.String(),
+		SiteKey:   widget.SiteKey,
+		Params:    widget.Params,
+		Proxy:     c.proxy,
+		UserAgent: resp.Request.Header.Get("User-Agent"),
+	}
+	if s.client.Jar != nil {
+		task.Cookies = s.client.Jar.Cookies(resp.Request.URL)
 	}
-	submitURL, err := resp.Request.URL.Parse(formMatch[1])
+	result, err := captcha.AsTaskSolver(s.CaptchaSolver).SolveTask(task.WithContext(c.Context()))
 	if err != nil {
-		s.logger.Printf("Warning: failed to parse captcha form action URL %q: %v", formMatch[1], err)
-		return nil, fmt.Errorf("captcha: invalid form action URL: %w", err)
+		return nil, fmt.Errorf("captcha solver failed: %w", err)
+	}
+	if result.UserAgent != "" && result.UserAgent != task.UserAgent {
+		s.logger.Printf("Warning: captcha was solved with User-Agent %q; the clearance may not match the scraper's\n", result.UserAgent)
 	}
+	c.Result.Answer, c.Result.Captcha = result.Token, result
+	token := result.Token
 
-	formData := url.Values{
-		"r":                     {s.extractRValue(body)},
-		"cf-turnstile-response": {token},
-		"g-recaptcha-response":  {token},
+	submitURL, formData, err := s.captchaSubmission(resp.Request.URL, page, body)
+	if err != nil {
+		// The token was never sent; a caching solver may still use it.
+		captcha.Release(result)
+		return nil, err
+	}
+	for _, field := range widget.Widget.responseFields() {
+		formData.Set(field, token)
 	}
 
-	return s.submitChallengeForm(submitURL.String(), resp.Request.URL.String(), formData, allowRefresh)
+	met := c.chain.len()
+	next, err := c.Submit(submitURL, formData)
+	s.reportCaptcha(c, result, met, err)
+	return next, err
+}
+
+// reportCaptcha tells the captcha provider whether the token in result was
+// accepted, judging by what followed its submission: another challenge means
+// it was rejected, reaching the page means it was accepted. met is the number
+// of challenges the request had met before the submission. Other outcomes,
+// such as a network error or a block page, say nothing about the token.
+func (s *Scraper) reportCaptcha(c *Challenge, result *captcha.Result, met int, submitErr error) {
+	if result.Reporter == nil {
+		return
+	}
+	var report func(*captcha.Result) error
+	verdict := "good"
+	switch next, ok := c.chain.attempt(met); {
+	case ok && !ChallengeKind(next.Kind).Blocked():
+		report, verdict = result.Reporter.ReportBad, "bad"
+	case !ok && submitErr == nil:
+		report = result.Reporter.ReportGood
+	default:
+		return
+	}
+	if err := report(result); err != nil {
+		s.logger.Printf("Warning: failed to report %s captcha token to %s: %v\n", verdict, result.SolverID, err)
+	}
 }
 
-func (s *Scraper) submitChallengeForm(submitURL, refererURL string, formData url.Values, allowRefresh bool) (*http.Response, error) {
-	req, _ := http.NewRequest("POST", submitURL, strings.NewReader(formData.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Referer", refererURL)
+// captchaSubmission determines where a solved captcha is posted and the hidden
+// fields that go with it. Older pages carry a challenge form in the HTML; modern
+// pages build it in JavaScript, in which case the endpoint and hidden fields are
+// taken from _cf_chl_opt, like solveModernJSChallenge does for JS challenges.
+func (s *Scraper) captchaSubmission(pageURL *url.URL, page *challengePage, body string) (string, url.Values, error) {
+	formData := url.Values{"r": {s.extractRValue(page)}}
+
+	if form := page.challengeForm(); form != nil && form.Action != "" {
+		submitURL, err := pageURL.Parse(form.Action)
+		if err != nil {
+			s.logger.Printf("Warning: failed to parse captcha form action URL %q: %v", form.Action, err)
+			return "", nil, fmt.Errorf("captcha: invalid form action URL: %w", err)
+		}
+		// Send the form's hidden fields along, as a browser would.
+		for name, values := range form.Fields {
+			formData[name] = append([]string(nil), values...)
+		}
+		if formData.Get("r") == "" {
+			formData.Set("r", s.extractRValue(page))
+		}
+		return submitURL.String(), formData, nil
+	}
 
-	return s.doWithRefresh(req, allowRefresh)
+	opt := parseChlOpt(body)
+	if opt == nil {
+		return "", nil, fmt.Errorf("captcha: could not find challenge form or _cf_chl_opt")
+	}
+	if md := opt["md"]; md != "" {
+		formData.Set("md", md)
+	}
+	// fa is the form action the challenge script would have used.
+	if action := opt["fa"]; action != "" {
+		submitURL, err := pageURL.Parse(action)
+		if err == nil {
+			return submitURL.String(), formData, nil
+		}
+		s.logger.Printf("Warning: failed to parse _cf_chl_opt form action %q: %v", action, err)
+	}
+	return s.buildModernSubmitURL(pageURL), formData, nil
 }
 
-func (s *Scraper) extractRValue(body string) string {
-	// First try the old format: name="r" value="..."
-	rValMatch := rValueOldRegex.FindStringSubmatch(body)
-	if len(rValMatch) > 1 {
-		return rValMatch[1]
+func (s *Scraper) extractRValue(page *challengePage) string {
+	// First try the old format: <input name="r" value="..."> in the challenge form
+	if form := page.challengeForm(); form != nil {
+		if r := form.Fields.Get("r"); r != "" {
+			return r
+		}
 	}
-	
+
 	// Try the modern format: r:'...' in __CF$cv$params
-	rParamsMatch := rValueModernRegex.FindStringSubmatch(body)
-	if len(rParamsMatch) > 1 {
-		return rParamsMatch[1]
+	for _, script := range page.Scripts {
+		if m := rValueModernRegex.FindStringSubmatch(script.Content); m != nil {
+			return m[1] + m[2]
+		}
 	}
-	
+
 	return ""
 }
 
@@ -213,14 +354,11 @@ func (s *Scraper) buildModernSubmitURL(originalURL *url.URL) string {
 	return submitURL.String()
 }
 
-func isChallengeResponse(resp *http.Response, body []byte) bool {
+// isCloudflareChallengeStatus reports whether resp was served by Cloudflare with
+// one of the status codes its challenge pages use.
+func isCloudflareChallengeStatus(resp *http.Response) bool {
 	if !strings.HasPrefix(resp.Header.Get("Server"), "cloudflare") {
 		return false
 	}
-	if resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusForbidden {
-		return false
-	}
-
-	bodyStr := string(body)
-	return jsV1DetectRegex.MatchString(bodyStr) || jsV2DetectRegex.MatchString(bodyStr) || captchaDetectRegex.MatchString(bodyStr)
+	return resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusForbidden
 }
@@ -0,0 +1,101 @@
+package cloudscraper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Advik-B/cloudscraper/lib/errors"
+)
+
+// DefaultMaxChallengeAttempts is the default number of challenges the scraper
+// attempts for a single request before giving up.
+const DefaultMaxChallengeAttempts = 3
+
+// challengeChain records the challenges met while serving one request. It
+// travels in the request context, so that a challenge served in response to a
+// submitted answer, or after the redirect that follows it, counts against the
+// same budget.
+type challengeChain struct {
+	attempts []errors.ChallengeAttempt
+}
+
+type challengeChainKey struct{}
+
+// withChallengeChain returns the chain carried by ctx, creating one if ctx has none.
+func withChallengeChain(ctx context.Context) (context.Context, *challengeChain) {
+	if chain, ok := ctx.Value(challengeChainKey{}).(*challengeChain); ok {
+		return ctx, chain
+	}
+	chain := &challengeChain{}
+	return context.WithValue(ctx, challengeChainKey{}, chain), chain
+}
+
+// add records attempt. It fails with errors.ErrChallengeLoop if the page is the
+// very challenge that was just answered, or if max challenges were already
+// attempted. A max of zero or less means DefaultMaxChallengeAttempts. Block
+// pages are recorded but never fail here; their own error is more telling.
+func (ch *challengeChain) add(attempt errors.ChallengeAttempt, max int) error {
+	if max <= 0 {
+		max = DefaultMaxChallengeAttempts
+	}
+	if ChallengeKind(attempt.Kind).Blocked() {
+		ch.attempts = append(ch.attempts, attempt)
+		return nil
+	}
+	if n := len(ch.attempts); n > 0 && sameChallenge(ch.attempts[n-1], attempt) {
+		ch.attempts = append(ch.attempts, attempt)
+		return fmt.Errorf("%w: the same challenge was served again after answering it", errors.ErrChallengeLoop)
+	}
+	if len(ch.attempts) >= max {
+		ch.attempts = append(ch.attempts, attempt)
+		return fmt.Errorf("%w: gave up after %d attempts", errors.ErrChallengeLoop, max)
+	}
+	ch.attempts = append(ch.attempts, attempt)
+	return nil
+}
+
+// len returns the number of recorded attempts. A nil chain has none.
+func (ch *challengeChain) len() int {
+	if ch == nil {
+		return 0
+	}
+	return len(ch.attempts)
+}
+
+// attempt returns the i-th recorded attempt, if there is one.
+func (ch *challengeChain) attempt(i int) (errors.ChallengeAttempt, bool) {
+	if i < 0 || i >= ch.len() {
+		return errors.ChallengeAttempt{}, false
+	}
+	return ch.attempts[i], true
+}
+
+// history returns a copy of the recorded attempts.
+func (ch *challengeChain) history() []errors.ChallengeAttempt {
+	return append([]errors.ChallengeAttempt(nil), ch.attempts...)
+}
+
+func sameChallenge(a, b errors.ChallengeAttempt) bool {
+	switch {
+	case a.CRay != "" || b.CRay != "":
+		return a.CRay == b.CRay
+	case a.Pass != "" || b.Pass != "":
+		return a.Pass == b.Pass
+	}
+	return false
+}
+
+// challengeAttempt describes the challenge page c for the chain.
+func challengeAttempt(c *Challenge) errors.ChallengeAttempt {
+	attempt := errors.ChallengeAttempt{
+		Kind:       string(c.Kind),
+		URL:        c.URL().String(),
+		StatusCode: c.Response.StatusCode,
+		RayID:      c.Response.Header.Get("cf-ray"),
+		CRay:       parseChlOpt(c.Body)["cRay"],
+	}
+	if form := parseChallengePage(c.Body).challengeForm(); form != nil {
+		attempt.Pass = form.Fields.Get("pass")
+	}
+	return attempt
+}
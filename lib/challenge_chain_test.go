@@ -0,0 +1,83 @@
+package cloudscraper
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/errors"
+	"github.com/Advik-B/cloudscraper/lib/stealth"
+)
+
+// rechallengeServer answers every request, including submitted answers, with a
+// modern JS challenge. With fixedRay set the same cRay is served every time.
+func rechallengeServer(fixedRay bool) (*httptest.Server, *int32) {
+	var served int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&served, 1)
+		ray := fmt.Sprintf("ray%d", n)
+		if fixedRay {
+			ray = "ray"
+		}
+		w.Header().Set("Server", "cloudflare")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `<html><body>
+<form id="challenge-form" action="/submit" method="POST"></form>
+<script>
+	window._cf_chl_opt = {cvId: '3', cRay: '`+ray+`'};
+	document.getElementById('jschl-answer').value = '42';
+</script></body></html>`)
+	}))
+	return server, &served
+}
+
+func TestChallengeAttemptBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixedRay bool
+		attempts int
+	}{
+		{"fresh challenge every time", false, 3},
+		{"identical challenge", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, served := rechallengeServer(tt.fixedRay)
+			defer server.Close()
+
+			s, err := New(
+				WithStealth(stealth.Options{Enabled: false}),
+				WithSessionConfig(false, time.Hour, 0),
+				WithChallengeDelay(0),
+				WithMaxChallengeAttempts(3),
+			)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			_, err = s.Get(server.URL)
+			if !stderrors.Is(err, errors.ErrChallengeLoop) {
+				t.Fatalf("error = %v, want ErrChallengeLoop", err)
+			}
+			var ce *errors.ChallengeError
+			if !stderrors.As(err, &ce) {
+				t.Fatalf("error %v is not a ChallengeError", err)
+			}
+			// The page that tripped the budget is recorded but not attempted.
+			if got := int(atomic.LoadInt32(served)); got != tt.attempts+1 {
+				t.Errorf("server hit %d times, want %d", got, tt.attempts+1)
+			}
+			if ce.Attempts != tt.attempts+1 || len(ce.History) != ce.Attempts {
+				t.Errorf("Attempts = %d, history = %d, want %d", ce.Attempts, len(ce.History), tt.attempts+1)
+			}
+			if ce.History[0].CRay == "" || ce.History[0].Kind != string(KindJSV2) {
+				t.Errorf("unexpected first attempt %+v", ce.History[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package cloudscraper
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/js"
+)
+
+// corpusPage describes an anonymised challenge page in testdata/challenges and
+// what the scraper is expected to make of it.
+type corpusPage struct {
+	file   string
+	status int
+	header map[string]string
+	kind   ChallengeKind
+
+	// Extracted fields; empty means not present on the page.
+	formAction string
+	r          string
+	jschlVc    string
+	pass       string
+	cRay       string
+	siteKey    string
+	widget     captchaWidget
+	delay      time.Duration
+	// answer is the computed answer for JS challenges, for domain example.com.
+	answer string
+}
+
+var challengeCorpus = []corpusPage{
+	{
+		file:       "v1.html",
+		status:     http.StatusServiceUnavailable,
+		kind:       KindJSV1,
+		formAction: "/cdn-cgi/l/chk_jschl?__cf_chl_jschl_tk__=a1b2c3d4e5f6a7b8c9d0",
+		r:          "0a1b2c3d4e5f60718293a4b5c6d7e8f9a0b1c2d3-1600000000-0-AQAAAA",
+		jschlVc:    "6e3b1f2a9c8d7e6f5a4b3c2d1e0f9a8b",
+		pass:       "1600000004.123-Zm9vYmFyYmF6",
+		delay:      4 * time.Second,
+		answer:     "43.0000000000",
+	},
+	{
+		file:       "v2.html",
+		status:     http.StatusServiceUnavailable,
+		kind:       KindJSV2,
+		formAction: "/?__cf_chl_f_tk=QmFzZTY0VG9rZW4tdjI",
+		r:          "cl9wYXJhbS12Mi1mcm9tLWZvcm0",
+		cRay:       "7e4c9a1b2d3f5a6b",
+		delay:      5 * time.Second,
+		answer:     "42",
+	},
+	{
+		file:   "managed.html",
+		status: http.StatusForbidden,
+		header: map[string]string{"cf-mitigated": "challenge"},
+		kind:   KindManaged,
+		cRay:   "8a2b3c4d5e6f7a8b",
+	},
+	{
+		file:    "turnstile_managed.html",
+		status:  http.StatusForbidden,
+		header:  map[string]string{"cf-mitigated": "challenge"},
+		kind:    KindManaged,
+		cRay:    "8a3c4d5e6f7a8b9c",
+		siteKey: "0x4AAAAAAADnPIDROrmt1Wwj",
+		widget:  widgetTurnstile,
+	},
+	{
+		file:       "hcaptcha.html",
+		status:     http.StatusForbidden,
+		kind:       KindCaptcha,
+		formAction: "/?__cf_chl_captcha_tk__=SENhcHRjaGFUb2tlbg",
+		r:          "aGNhcHRjaGEtci12YWx1ZQ",
+		siteKey:    "33f96e6a-38cd-421b-bb68-7806e1764460",
+		widget:     widgetHCaptcha,
+	},
+	{file: "block_1010.html", status: http.StatusForbidden, kind: KindBrowserBanned},
+	{file: "block_1015.html", status: http.StatusTooManyRequests, kind: KindRateLimited},
+	{file: "block_1020.html", status: http.StatusForbidden, kind: KindAccessDenied},
+	{file: "jsd.html", status: http.StatusForbidden, kind: KindJSDetection, r: "8b9c0d1e2f3a4b5c"},
+}
+
+func loadCorpusPage(t *testing.T, p corpusPage) (*http.Response, string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "challenges", p.file))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	reqURL, _ := url.Parse("https://example.com/protected?q=1")
+	resp := &http.Response{
+		StatusCode: p.status,
+		Header:     http.Header{"Server": {"cloudflare"}},
+		Request:    &http.Request{Method: "GET", URL: reqURL},
+	}
+	for k, v := range p.header {
+		resp.Header.Set(k, v)
+	}
+	return resp, string(data)
+}
+
+func TestChallengeCorpus_Detection(t *testing.T) {
+	s := newTestScraper(t, time.Hour, 0)
+	for _, p := range challengeCorpus {
+		t.Run(p.file, func(t *testing.T) {
+			resp, body := loadCorpusPage(t, p)
+
+			if got := ClassifyChallenge(resp, body); got != p.kind {
+				t.Errorf("ClassifyChallenge = %q, want %q", got, p.kind)
+			}
+
+			page := parseChallengePage(body)
+			var action, jschlVc, pass string
+			if form := page.challengeForm(); form != nil {
+				action, jschlVc, pass = form.Action, form.Fields.Get("jschl_vc"), form.Fields.Get("pass")
+			}
+			check := func(field, got, want string) {
+				if got != want {
+					t.Errorf("%s = %q, want %q", field, got, want)
+				}
+			}
+			check("form action", action, p.formAction)
+			check("jschl_vc", jschlVc, p.jschlVc)
+			check("pass", pass, p.pass)
+			check("r", s.extractRValue(page), p.r)
+			check("cRay", parseChlOpt(body)["cRay"], p.cRay)
+
+			if p.siteKey != "" {
+				cp, err := parseCaptchaPage(page, body)
+				if err != nil {
+					t.Fatalf("parseCaptchaPage: %v", err)
+				}
+				check("site key", cp.SiteKey, p.siteKey)
+				check("widget", string(cp.Widget), string(p.widget))
+			}
+
+			if p.delay != 0 {
+				d, ok := page.delayHint()
+				if !ok || d != p.delay {
+					t.Errorf("delay hint = %v (found %v), want %v", d, ok, p.delay)
+				}
+			}
+		})
+	}
+}
+
+// corpusEngines returns the JS engines available to solve the corpus with: the
+// built-in goja engine, and node when it is installed.
+func corpusEngines(t *testing.T) map[string]js.Engine {
+	engines := map[string]js.Engine{"goja": js.NewGojaEngine()}
+	if _, err := exec.LookPath("node"); err == nil {
+		node, err := js.NewExternalEngine("node")
+		if err != nil {
+			t.Fatalf("NewExternalEngine(node): %v", err)
+		}
+		engines["node"] = node
+	}
+	return engines
+}
+
+func TestChallengeCorpus_Answers(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	for name, engine := range corpusEngines(t) {
+		for _, p := range challengeCorpus {
+			if p.answer == "" {
+				continue
+			}
+			t.Run(name+"/"+p.file, func(t *testing.T) {
+				_, body := loadCorpusPage(t, p)
+
+				var answer string
+				switch p.kind {
+				case KindJSV1:
+					var err error
+					answer, err = solveV1Logic(body, "example.com", engine)
+					if err != nil {
+						t.Fatalf("solveV1Logic: %v", err)
+					}
+				case KindJSV2:
+					res, err := solveV2Logic(body, "example.com", engine, logger)
+					if err != nil {
+						t.Fatalf("solveV2Logic: %v", err)
+					}
+					answer = res.Value
+				default:
+					t.Fatalf("no solver for kind %q", p.kind)
+				}
+				if answer != p.answer {
+					t.Errorf("answer = %q, want %q", answer, p.answer)
+				}
+			})
+		}
+	}
+}
+
+func TestBuildModernSubmitURL(t *testing.T) {
+	s := newTestScraper(t, time.Hour, 0)
+	tests := []struct {
+		page string
+		want string
+	}{
+		{"https://example.com/protected?q=1", "https://example.com/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1"},
+		{"http://example.com:8080/a/b/", "http://example.com:8080/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.page)
+		if got := s.buildModernSubmitURL(u); got != tt.want {
+			t.Errorf("buildModernSubmitURL(%s) = %q, want %q", tt.page, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package cloudscraper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/captcha"
+)
+
+const (
+	// ServerChallengeDelay makes the scraper wait as long as the challenge page
+	// asks before submitting an answer. It is the default ChallengeDelay.
+	ServerChallengeDelay time.Duration = -1
+
+	// defaultChallengeDelay is used when the page does not hint at a delay.
+	defaultChallengeDelay = 4 * time.Second
+	// maxChallengeDelay caps the delay a page can impose.
+	maxChallengeDelay = 30 * time.Second
+)
+
+// SolveResult records how a challenge was solved.
+type SolveResult struct {
+	// Answer is the computed JS answer, or the captcha token.
+	Answer string
+	// Delay is the wait before submission: the configured ChallengeDelay, or the
+	// server hint when Hinted is set.
+	Delay  time.Duration
+	Hinted bool
+	// Waited is the time actually spent waiting, which is shorter than Delay when
+	// solving took part of it, or when the request context was cancelled.
+	Waited time.Duration
+	// Captcha is the solver's result for captcha challenges.
+	Captcha *captcha.Result
+}
+
+// challengeDelay determines how long to wait before submitting the answer to
+// a challenge page.
+func (s *Scraper) challengeDelay(page *challengePage) (delay time.Duration, hinted bool) {
+	if s.opts.ChallengeDelay >= 0 {
+		return s.opts.ChallengeDelay, false
+	}
+	if d, ok := page.delayHint(); ok {
+		return d, true
+	}
+	return defaultChallengeDelay, false
+}
+
+// waitChallengeDelay waits out the challenge delay before an answer is submitted.
+func (s *Scraper) waitChallengeDelay(c *Challenge, page *challengePage) error {
+	delay, hinted := s.challengeDelay(page)
+	if hinted {
+		s.logger.Printf("Waiting %v before submitting, as the challenge page asks\n", delay)
+	}
+	if err := c.wait(delay, hinted); err != nil {
+		return fmt.Errorf("challenge wait cancelled: %w", err)
+	}
+	return nil
+}
+
+// wait blocks until delay has passed since the challenge page was received, or
+// until the request is cancelled. The outcome is recorded in c.Result.
+func (c *Challenge) wait(delay time.Duration, hinted bool) error {
+	c.Result.Delay, c.Result.Hinted = delay, hinted
+
+	remaining := time.Until(c.received.Add(delay))
+	if remaining <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	start := time.Now()
+	select {
+	case <-timer.C:
+		c.Result.Waited = time.Since(start)
+		return nil
+	case <-c.Context().Done():
+		c.Result.Waited = time.Since(start)
+		return c.Context().Err()
+	}
+}
+
+// delayHint returns the delay the challenge scripts schedule their submission
+// with, i.e. the longest literal setTimeout delay, capped at maxChallengeDelay.
+func (p *challengePage) delayHint() (time.Duration, bool) {
+	var longest time.Duration
+	found := false
+	for _, script := range p.Scripts {
+		for _, d := range setTimeoutDelays(script.Content) {
+			if d > longest {
+				longest = d
+			}
+			found = true
+		}
+	}
+	if longest > maxChallengeDelay {
+		longest = maxChallengeDelay
+	}
+	return longest, found
+}
+
+// setTimeoutDelays returns the numeric delays passed to setTimeout in script.
+// Calls whose delay is not a number literal are skipped.
+func setTimeoutDelays(script string) []time.Duration {
+	var delays []time.Duration
+	for rest := script; ; {
+		i := strings.Index(rest, "setTimeout(")
+		if i < 0 {
+			return delays
+		}
+		rest = rest[i+len("setTimeout("):]
+		if arg, ok := secondArgument(rest); ok {
+			if ms, err := strconv.ParseFloat(arg, 64); err == nil && ms >= 0 {
+				delays = append(delays, time.Duration(ms*float64(time.Millisecond)))
+			}
+		}
+	}
+}
+
+// secondArgument returns the trimmed source of the second argument of a call
+// whose argument list starts at args, skipping over nested brackets and string
+// literals in the first argument.
+func secondArgument(args string) (string, bool) {
+	depth := 0
+	start := -1
+	for i := 0; i < len(args); i++ {
+		switch c := args[i]; c {
+		case '\'', '"', '`':
+			if j := strings.IndexByte(args[i+1:], c); j >= 0 {
+				i += j + 1
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				if start < 0 {
+					return "", false
+				}
+				return strings.TrimSpace(args[start:i]), true
+			}
+			depth--
+		case ',':
+			if depth != 0 {
+				continue
+			}
+			if start >= 0 {
+				return strings.TrimSpace(args[start:i]), true
+			}
+			start = i + 1
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,117 @@
+package cloudscraper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Advik-B/cloudscraper/lib/stealth"
+)
+
+func TestSetTimeoutDelays(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []time.Duration
+	}{
+		{`setTimeout(function(){ var t = s.substr(0, 15); f.submit(); }, 4000);`, []time.Duration{4 * time.Second}},
+		{`setTimeout(() => { go("a,b") }, 5e3)`, []time.Duration{5 * time.Second}},
+		{`setTimeout(submit, 1500); setTimeout(tick, 250)`, []time.Duration{1500 * time.Millisecond, 250 * time.Millisecond}},
+		{`setTimeout(submit, delay)`, nil},
+		{`setTimeout(submit)`, nil},
+	}
+	for _, tt := range tests {
+		got := setTimeoutDelays(tt.script)
+		if len(got) != len(tt.want) {
+			t.Errorf("setTimeoutDelays(%q) = %v, want %v", tt.script, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("setTimeoutDelays(%q) = %v, want %v", tt.script, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestChallengeWaitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Challenge{ctx: ctx, received: time.Now()}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	err := c.wait(time.Hour, true)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait error = %v, want context.Canceled", err)
+	}
+	if c.Result.Delay != time.Hour || !c.Result.Hinted || c.Result.Waited >= time.Second {
+		t.Errorf("unexpected result %+v", c.Result)
+	}
+}
+
+// v2DelayServer serves a modern JS challenge whose script asks for hint
+// milliseconds before submission, and the protected page once it is answered.
+func v2DelayServer(hint string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			_ = r.ParseForm()
+			if r.PostForm.Get("jschl_answer") == "42" {
+				_, _ = io.WriteString(w, "welcome")
+				return
+			}
+		}
+		w.Header().Set("Server", "cloudflare")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `<html><body>
+<form id="challenge-form" action="/submit" method="POST"></form>
+<script>
+	window._cf_chl_opt = {cvId: '3'};
+	setTimeout(function() { document.getElementById('jschl-answer').value = '42'; }, `+hint+`);
+</script></body></html>`)
+	}))
+}
+
+func TestSolveModernJSChallenge_WaitsServerHint(t *testing.T) {
+	server := v2DelayServer("300")
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		opts    []ScraperOption
+		minWait time.Duration
+		maxWait time.Duration
+	}{
+		{"server hint", nil, 300 * time.Millisecond, 3 * time.Second},
+		{"zero override", []ScraperOption{WithChallengeDelay(0)}, 0, 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ScraperOption{
+				WithStealth(stealth.Options{Enabled: false}),
+				WithSessionConfig(false, time.Hour, 0),
+			}, tt.opts...)
+			s, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			start := time.Now()
+			resp, err := s.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			drainBody(resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minWait || elapsed > tt.maxWait {
+				t.Errorf("request took %v, want between %v and %v", elapsed, tt.minWait, tt.maxWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package cloudscraper
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// challengePage is the part of a challenge page's HTML the solvers rely on. It
+// is built with an HTML tokenizer, so attribute order, quoting and whitespace
+// don't matter.
+type challengePage struct {
+	Forms []challengeForm
+	// Scripts holds the inline scripts in document order.
+	Scripts []inlineScript
+	// ScriptSrcs holds the src of every external script, lower-cased.
+	ScriptSrcs []string
+	// Widget holds the attributes of the first element carrying data-sitekey,
+	// keyed by lower-cased name, or nil if there is none.
+	Widget map[string]string
+}
+
+// challengeForm is a <form> element and the named inputs inside it.
+type challengeForm struct {
+	ID     string
+	Class  string
+	Action string
+	Method string
+	Fields url.Values
+}
+
+// inlineScript is a <script> element without a src attribute.
+type inlineScript struct {
+	// Element is the raw markup of the whole element.
+	Element string
+	Content string
+}
+
+// parseChallengePage tokenizes body and collects its forms, scripts and
+// captcha widget. Malformed markup is tolerated the way browsers tolerate it.
+func parseChallengePage(body string) *challengePage {
+	page := &challengePage{}
+	z := html.NewTokenizer(strings.NewReader(body))
+
+	var form *challengeForm
+	var script *inlineScript
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if form != nil {
+				page.Forms = append(page.Forms, *form)
+			}
+			return page
+
+		case html.TextToken:
+			if script != nil {
+				script.Element += string(z.Raw())
+				script.Content += string(z.Text())
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := string(z.Raw())
+			tok := z.Token()
+			attrs := tagAttrs(tok)
+			if _, ok := attrs["data-sitekey"]; ok && page.Widget == nil {
+				page.Widget = attrs
+			}
+			switch tok.Data {
+			case "form":
+				if form != nil {
+					// Browsers ignore nested forms; keep collecting into the outer one.
+					continue
+				}
+				form = &challengeForm{
+					ID:     attrs["id"],
+					Class:  attrs["class"],
+					Action: attrs["action"],
+					Method: strings.ToUpper(attrs["method"]),
+					Fields: url.Values{},
+				}
+			case "input":
+				if form != nil && attrs["name"] != "" {
+					form.Fields.Add(attrs["name"], attrs["value"])
+				}
+			case "script":
+				if src, ok := attrs["src"]; ok {
+					page.ScriptSrcs = append(page.ScriptSrcs, strings.ToLower(src))
+				} else if tt == html.StartTagToken {
+					script = &inlineScript{Element: raw}
+				}
+			}
+
+		case html.EndTagToken:
+			switch z.Token().Data {
+			case "form":
+				if form != nil {
+					page.Forms = append(page.Forms, *form)
+					form = nil
+				}
+			case "script":
+				if script != nil {
+					script.Element += "</script>"
+					page.Scripts = append(page.Scripts, *script)
+					script = nil
+				}
+			}
+		}
+	}
+}
+
+// tagAttrs returns the attributes of a start tag keyed by name. The tokenizer
+// already lower-cases names; the first occurrence of a duplicate wins, as in
+// browsers.
+func tagAttrs(tok html.Token) map[string]string {
+	attrs := make(map[string]string, len(tok.Attr))
+	for _, a := range tok.Attr {
+		if _, ok := attrs[a.Key]; !ok {
+			attrs[a.Key] = a.Val
+		}
+	}
+	return attrs
+}
+
+// challengeForm returns the challenge form of the page: the form with the
+// challenge-form id or class, or failing that the first form carrying the
+// jschl_vc or pass fields. It returns nil if there is none.
+func (p *challengePage) challengeForm() *challengeForm {
+	for i := range p.Forms {
+		f := &p.Forms[i]
+		if f.ID == "challenge-form" || hasClass(f.Class, "challenge-form") {
+			return f
+		}
+	}
+	for i := range p.Forms {
+		f := &p.Forms[i]
+		if f.Fields.Has("jschl_vc") || f.Fields.Has("pass") {
+			return f
+		}
+	}
+	return nil
+}
+
+// chlOptScripts returns the inline scripts that set up a modern challenge, in
+// the [element, content] shape the JS engines take.
+func (p *challengePage) chlOptScripts() [][]string {
+	var matches [][]string
+	for _, s := range p.Scripts {
+		if strings.Contains(s.Content, "window._cf_chl_opt") {
+			matches = append(matches, []string{s.Element, s.Content})
+		}
+	}
+	return matches
+}
+
+func hasClass(class, name string) bool {
+	for _, c := range strings.Fields(class) {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package cloudscraper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChallengePage_FormAnyAttributeOrder(t *testing.T) {
+	bodies := []string{
+		`<form class="challenge-form" id="challenge-form" action="/cdn-cgi/l/chk_jschl?__cf_chl_f_tk=abc" method="POST">
+			<input type="hidden" name="r" value="rval"/>
+			<input type="hidden" name="jschl_vc" value="vc123"/>
+			<input type="hidden" name="pass" value="1700000000.123-xyz"/>
+		</form>`,
+		`<FORM method='post' action='/cdn-cgi/l/chk_jschl?__cf_chl_f_tk=abc' id='challenge-form'>
+			<input value='rval' name='r' type='hidden'>
+			<input name = 'jschl_vc'  value = 'vc123' >
+			<input name='pass' value='1700000000.123-xyz'>
+		</FORM>`,
+		`<div><form
+			action="/cdn-cgi/l/chk_jschl?__cf_chl_f_tk=abc"
+			method="POST"><input name="jschl_vc" value="vc123"><input name="pass" value="1700000000.123-xyz"><input name="r" value="rval"></form></div>`,
+	}
+	for i, body := range bodies {
+		form := parseChallengePage(body).challengeForm()
+		if form == nil {
+			t.Fatalf("body %d: challenge form not found", i)
+		}
+		if form.Action != "/cdn-cgi/l/chk_jschl?__cf_chl_f_tk=abc" {
+			t.Errorf("body %d: action = %q", i, form.Action)
+		}
+		if form.Method != "POST" {
+			t.Errorf("body %d: method = %q", i, form.Method)
+		}
+		for name, want := range map[string]string{"r": "rval", "jschl_vc": "vc123", "pass": "1700000000.123-xyz"} {
+			if got := form.Fields.Get(name); got != want {
+				t.Errorf("body %d: %s = %q, want %q", i, name, got, want)
+			}
+		}
+	}
+}
+
+func TestParseChallengePage_ChlOptScripts(t *testing.T) {
+	body := `<script src="/cdn-cgi/challenge-platform/h/b/orchestrate/chl_page/v1"></script>
+<script>var unrelated = "</div>";</script>
+<script type="text/javascript">
+	(function(){window._cf_chl_opt={cvId: '3',cType: 'non-interactive'};})();
+</script>
+<script>var after = 1;</script>`
+
+	page := parseChallengePage(body)
+	scripts := page.chlOptScripts()
+	if len(scripts) != 1 {
+		t.Fatalf("got %d challenge scripts, want 1", len(scripts))
+	}
+	content := scripts[0][1]
+	if strings.Contains(content, "unrelated") || strings.Contains(content, "after") {
+		t.Errorf("challenge script spans neighbouring scripts: %q", content)
+	}
+	if !strings.Contains(content, "window._cf_chl_opt") {
+		t.Errorf("challenge script content = %q", content)
+	}
+	if len(page.ScriptSrcs) != 1 {
+		t.Errorf("script srcs = %v", page.ScriptSrcs)
+	}
+}
+
+func TestExtractRValue(t *testing.T) {
+	s := newTestScraper(t, 0, 0)
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`<form id="challenge-form" action="/x"><input name='r' value='from-form'></form>`, "from-form"},
+		{`<script>window.__CF$cv$params={r:'single',t:'MTcwMA=='};</script>`, "single"},
+		{`<script>window.__CF$cv$params={r: "double",t:"MTcwMA=="};</script>`, "double"},
+		{`<p>no r here</p>`, ""},
+	}
+	for _, tt := range tests {
+		if got := s.extractRValue(parseChallengePage(tt.body)); got != tt.want {
+			t.Errorf("extractRValue(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
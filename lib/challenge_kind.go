@@ -0,0 +1,121 @@
+package cloudscraper
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Advik-B/cloudscraper/lib/errors"
+)
+
+// ChallengeKind classifies a Cloudflare interstitial page.
+type ChallengeKind string
+
+const (
+	// KindNone means the response is not a recognised Cloudflare page.
+	KindNone ChallengeKind = ""
+	// KindJSV1 is the classic jschl arithmetic challenge.
+	KindJSV1 ChallengeKind = "js-v1"
+	// KindJSV2 is the modern non-interactive JS challenge driven by _cf_chl_opt.
+	KindJSV2 ChallengeKind = "js-v2"
+	// KindManaged is the "Just a moment..." managed (or interactive) challenge.
+	KindManaged ChallengeKind = "managed"
+	// KindCaptcha is a page embedding a Turnstile, hCaptcha or reCAPTCHA widget.
+	KindCaptcha ChallengeKind = "captcha"
+	// KindJSDetection is a regular error page that only carries Cloudflare's
+	// JavaScript-detection beacon. It is not a challenge and is not handled.
+	KindJSDetection ChallengeKind = "js-detection"
+	// KindAccessDenied is the firewall block page (error 1020).
+	KindAccessDenied ChallengeKind = "access-denied"
+	// KindRateLimited is the rate-limit page (error 1015).
+	KindRateLimited ChallengeKind = "rate-limited"
+	// KindBrowserBanned is the browser-signature ban page (error 1010).
+	KindBrowserBanned ChallengeKind = "browser-banned"
+)
+
+// Solvable reports whether a solver can, in principle, pass this kind of page.
+// Block pages are final: retrying them only prolongs the ban.
+func (k ChallengeKind) Solvable() bool {
+	switch k {
+	case KindJSV1, KindJSV2, KindManaged, KindCaptcha:
+		return true
+	}
+	return false
+}
+
+// Blocked reports whether this kind is a Cloudflare block page.
+func (k ChallengeKind) Blocked() bool {
+	switch k {
+	case KindAccessDenied, KindRateLimited, KindBrowserBanned:
+		return true
+	}
+	return false
+}
+
+var (
+	cfErrorCodeRegex = regexp.MustCompile(`(?i)(?:cf-error-code[^>]*>\s*|error(?:\s|&nbsp;|code:?|</?span[^>]*>)*)(10(?:10|15|20))\b`)
+	jsdBeaconRegex   = regexp.MustCompile(`(?i)/cdn-cgi/challenge-platform/(?:h/[a-z]/)?scripts/jsd/`)
+	chlOptRegex      = regexp.MustCompile(`_cf_chl_opt\s*=`)
+)
+
+// blockKinds maps Cloudflare error codes to the block kind they represent.
+var blockKinds = map[string]ChallengeKind{
+	"1010": KindBrowserBanned,
+	"1015": KindRateLimited,
+	"1020": KindAccessDenied,
+}
+
+// ClassifyChallenge determines which kind of Cloudflare page resp is. body is
+// the already-read response body.
+func ClassifyChallenge(resp *http.Response, body string) ChallengeKind {
+	if !strings.HasPrefix(resp.Header.Get("Server"), "cloudflare") {
+		return KindNone
+	}
+
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		if m := cfErrorCodeRegex.FindStringSubmatch(body); m != nil {
+			return blockKinds[m[1]]
+		}
+	}
+	if !isCloudflareChallengeStatus(resp) {
+		return KindNone
+	}
+
+	switch cType := parseChlOpt(body)["cType"]; {
+	case cType == "managed" || cType == "interactive":
+		return KindManaged
+	case chlOptRegex.MatchString(body):
+		return KindJSV2
+	case resp.Header.Get("cf-mitigated") == "challenge":
+		return KindManaged
+	case jsV1DetectRegex.MatchString(body):
+		return KindJSV1
+	case captchaDetectRegex.MatchString(body):
+		return KindCaptcha
+	case jsdBeaconRegex.MatchString(body) && !strings.Contains(body, "/orchestrate/"):
+		// The beacon lives under /cdn-cgi/challenge-platform/ too, so it must be
+		// ruled out before the generic v2 marker below.
+		return KindJSDetection
+	case jsV2DetectRegex.MatchString(body):
+		return KindJSV2
+	}
+	return KindNone
+}
+
+// blockedError builds the error returned for a block page of the given kind.
+func blockedError(kind ChallengeKind) error {
+	var specific error
+	switch kind {
+	case KindAccessDenied:
+		specific = errors.ErrAccessDenied
+	case KindRateLimited:
+		specific = errors.ErrRateLimited
+	case KindBrowserBanned:
+		specific = errors.ErrBrowserBanned
+	default:
+		return fmt.Errorf("%w: %s", errors.ErrBlocked, kind)
+	}
+	return fmt.Errorf("%w: %w", errors.ErrBlocked, specific)
+}
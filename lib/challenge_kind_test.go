@@ -0,0 +1,98 @@
+package cloudscraper
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cserrors "github.com/Advik-B/cloudscraper/lib/errors"
+)
+
+func cfResponse(status int, headers ...string) *http.Response {
+	h := http.Header{"Server": {"cloudflare"}}
+	for i := 0; i+1 < len(headers); i += 2 {
+		h.Set(headers[i], headers[i+1])
+	}
+	return &http.Response{StatusCode: status, Header: h}
+}
+
+func TestClassifyChallenge(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		body string
+		want ChallengeKind
+	}{
+		{"origin 403", &http.Response{StatusCode: 403, Header: http.Header{"Server": {"nginx"}}}, `Error 1020`, KindNone},
+		{"access denied", cfResponse(403), `<span class="cf-error-code">1020</span>`, KindAccessDenied},
+		{"rate limited", cfResponse(429), `<h1><span>Error</span><span>1015</span></h1>`, KindRateLimited},
+		{"browser banned", cfResponse(403), `Error code: 1010`, KindBrowserBanned},
+		{"managed via cType", cfResponse(403), `window._cf_chl_opt={cvId: '3',cType: 'managed',cRay: 'abc'};`, KindManaged},
+		{"managed via header", cfResponse(403, "cf-mitigated", "challenge"), `<title>Just a moment...</title>`, KindManaged},
+		{"non-interactive", cfResponse(503), `window._cf_chl_opt={cType: 'non-interactive'};`, KindJSV2},
+		{"v1", cfResponse(503), `<img src="/cdn-cgi/images/trace/jsch/js/transparent.gif">`, KindJSV1},
+		{"captcha", cfResponse(403), `<div class="cf-turnstile" data-sitekey="0x4AAA"></div>`, KindCaptcha},
+		{"jsd beacon", cfResponse(403), `<script src="/cdn-cgi/challenge-platform/h/b/scripts/jsd/abc/main.js"></script>`, KindJSDetection},
+		{"plain 200", cfResponse(200), `<html>ok</html>`, KindNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyChallenge(tt.resp, tt.body); got != tt.want {
+				t.Errorf("ClassifyChallenge = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockedError(t *testing.T) {
+	err := blockedError(KindAccessDenied)
+	if !errors.Is(err, cserrors.ErrBlocked) || !errors.Is(err, cserrors.ErrAccessDenied) {
+		t.Errorf("blockedError(%q) = %v, want ErrBlocked and ErrAccessDenied", KindAccessDenied, err)
+	}
+	if KindAccessDenied.Solvable() || !KindManaged.Solvable() {
+		t.Error("Solvable misclassifies block and managed pages")
+	}
+}
+
+func TestParseChlOpt(t *testing.T) {
+	body := `<script>(function(){window._cf_chl_opt={cvId: '3',cZone: "example.com",cType: 'managed',cRay: '8a1b2c3d',cTplV:5,cRq: {ru: 'aHR0cHM6Ly9', ra: 'TW96'},fa:"/?__cf_chl_f_tk=abc",md: 'xyz'};})();</script>`
+	opt := parseChlOpt(body)
+	want := map[string]string{"cvId": "3", "cZone": "example.com", "cType": "managed", "cRay": "8a1b2c3d", "cTplV": "5", "fa": "/?__cf_chl_f_tk=abc", "md": "xyz"}
+	for k, v := range want {
+		if opt[k] != v {
+			t.Errorf("opt[%q] = %q, want %q", k, opt[k], v)
+		}
+	}
+	if _, ok := opt["ru"]; ok {
+		t.Error("nested cRq fields should not be returned")
+	}
+	if parseChlOpt("<html></html>") != nil {
+		t.Error("expected nil for a page without _cf_chl_opt")
+	}
+}
+
+func TestChallengeError_CarriesPageMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cloudflare")
+		w.Header().Set("cf-ray", "8a1b2c3d4e5f6a7b-AMS")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `<span class="cf-error-code">1020</span><script>window._cf_chl_opt={cType: 'managed', cRay: '8a1b2c3d4e5f6a7b', cZone: 'example.com'};</script>`)
+	}))
+	defer server.Close()
+
+	_, err := newTestScraper(t, time.Hour, 1).Get(server.URL + "/page")
+	var ce *cserrors.ChallengeError
+	if !errors.As(err, &ce) {
+		t.Fatalf("Get error = %v, want a ChallengeError", err)
+	}
+	if !errors.Is(err, cserrors.ErrAccessDenied) {
+		t.Errorf("ChallengeError should wrap ErrAccessDenied: %v", err)
+	}
+	if ce.Kind != string(KindAccessDenied) || ce.RayID != "8a1b2c3d4e5f6a7b-AMS" || ce.StatusCode != 403 ||
+		ce.CRay != "8a1b2c3d4e5f6a7b" || ce.CZone != "example.com" || ce.CType != "managed" || ce.Solver != HandlerBlock {
+		t.Errorf("ChallengeError = %+v", ce)
+	}
+}
@@ -0,0 +1,301 @@
+package cloudscraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the built-in challenge handlers, in their default order.
+const (
+	HandlerBlock   = "block"
+	HandlerManaged = "managed"
+	HandlerJSV2    = "js-v2"
+	HandlerJSV1    = "js-v1"
+	HandlerCaptcha = "captcha"
+)
+
+// ChallengeDetector recognises a challenge page.
+type ChallengeDetector interface {
+	// Detect reports whether resp, whose body has already been read into body,
+	// is a challenge this detector is responsible for.
+	Detect(resp *http.Response, body string) bool
+}
+
+// ChallengeHandler recognises and solves one kind of challenge.
+type ChallengeHandler interface {
+	ChallengeDetector
+	// Name identifies the handler within a ChallengeRegistry.
+	Name() string
+	// Solve answers the challenge and returns the response of the protected resource.
+	Solve(c *Challenge) (*http.Response, error)
+}
+
+// Challenge is a detected challenge page handed to a ChallengeHandler.
+type Challenge struct {
+	Scraper  *Scraper
+	Response *http.Response
+	Body     string
+	// Kind is the classification of the page, see ClassifyChallenge.
+	Kind ChallengeKind
+	// Result is filled in by the built-in solvers.
+	Result SolveResult
+
+	// ctx is the context of the challenged request. The response's own request
+	// carries the client's per-attempt context, which ends with its body.
+	ctx context.Context
+	// chain is the history of challenges met while serving the request.
+	chain *challengeChain
+	// submitURL and submitForm record the last submission, for captures.
+	submitURL  string
+	submitForm url.Values
+	// proxy is the proxy the challenged request went through, if any.
+	proxy *url.URL
+	// received is when the challenge page arrived; submission delays count from it.
+	received time.Time
+	// allowRefresh is threaded through the challenge-solving chain so that a form
+	// submission fired from inside refreshSession's probe (allowRefresh=false)
+	// cannot re-enter the singleflight group that probe is already holding.
+	allowRefresh bool
+}
+
+// URL returns the URL of the page that served the challenge.
+func (c *Challenge) URL() *url.URL {
+	return c.Response.Request.URL
+}
+
+// Context returns the context of the request that was challenged.
+func (c *Challenge) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Submit posts a solved challenge form to submitURL, with the challenge page as
+// referer, and follows the result through the scraper. If the server answers
+// with another challenge it is handled in turn.
+func (c *Challenge) Submit(submitURL string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.Context(), "POST", submitURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build challenge submission: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", c.URL().String())
+	c.submitURL, c.submitForm = submitURL, form
+
+	return c.Scraper.doWithRefresh(req, c.allowRefresh)
+}
+
+// challengeHandler adapts a pair of functions to the ChallengeHandler interface.
+type challengeHandler struct {
+	name   string
+	detect func(resp *http.Response, body string) bool
+	solve  func(c *Challenge) (*http.Response, error)
+}
+
+// NewChallengeHandler builds a ChallengeHandler from a detection and a solving function.
+func NewChallengeHandler(name string, detect func(resp *http.Response, body string) bool, solve func(c *Challenge) (*http.Response, error)) ChallengeHandler {
+	return &challengeHandler{name: name, detect: detect, solve: solve}
+}
+
+func (h *challengeHandler) Name() string { return h.name }
+
+func (h *challengeHandler) Detect(resp *http.Response, body string) bool {
+	return h.detect(resp, body)
+}
+
+func (h *challengeHandler) Solve(c *Challenge) (*http.Response, error) {
+	return h.solve(c)
+}
+
+// DefaultChallengeHandlers returns the built-in handlers in their default order:
+// block pages, managed challenges, modern (v2/v3) JS challenges, classic (v1) JS
+// challenges, then captcha/Turnstile. Each one handles the pages ClassifyChallenge
+// assigns to its kind.
+func DefaultChallengeHandlers() []ChallengeHandler {
+	return []ChallengeHandler{
+		NewChallengeHandler(HandlerBlock, func(resp *http.Response, body string) bool {
+			return ClassifyChallenge(resp, body).Blocked()
+		}, func(c *Challenge) (*http.Response, error) {
+			// Block pages cannot be solved; fail fast instead of retrying.
+			return nil, blockedError(c.Kind)
+		}),
+		NewChallengeHandler(HandlerManaged, func(resp *http.Response, body string) bool {
+			return ClassifyChallenge(resp, body) == KindManaged
+		}, func(c *Challenge) (*http.Response, error) {
+			// A managed challenge escalates to a widget when the visitor looks
+			// suspicious; otherwise it runs the same JS flow as a v2 challenge.
+			if captchaDetectRegex.MatchString(c.Body) {
+				return c.Scraper.solveCaptchaChallenge(c)
+			}
+			return c.Scraper.solveModernJSChallenge(c)
+		}),
+		NewChallengeHandler(HandlerJSV2, func(resp *http.Response, body string) bool {
+			return ClassifyChallenge(resp, body) == KindJSV2
+		}, func(c *Challenge) (*http.Response, error) {
+			return c.Scraper.solveModernJSChallenge(c)
+		}),
+		NewChallengeHandler(HandlerJSV1, func(resp *http.Response, body string) bool {
+			return ClassifyChallenge(resp, body) == KindJSV1
+		}, func(c *Challenge) (*http.Response, error) {
+			return c.Scraper.solveClassicJSChallenge(c)
+		}),
+		NewChallengeHandler(HandlerCaptcha, func(resp *http.Response, body string) bool {
+			return ClassifyChallenge(resp, body) == KindCaptcha
+		}, func(c *Challenge) (*http.Response, error) {
+			return c.Scraper.solveCaptchaChallenge(c)
+		}),
+	}
+}
+
+// newScraperRegistry builds the registry of a new Scraper: custom handlers first,
+// followed by the built-in handlers they do not replace.
+func newScraperRegistry(custom []ChallengeHandler) *ChallengeRegistry {
+	r := NewChallengeRegistry(custom...)
+	for _, h := range DefaultChallengeHandlers() {
+		if r.index(h.Name()) < 0 {
+			r.handlers = append(r.handlers, h)
+		}
+	}
+	return r
+}
+
+// ChallengeRegistry holds the ordered set of challenge handlers a Scraper
+// consults for every response. It is safe for concurrent use.
+type ChallengeRegistry struct {
+	mu       sync.RWMutex
+	handlers []ChallengeHandler
+	disabled map[string]bool
+}
+
+// NewChallengeRegistry creates a registry holding the given handlers in order.
+func NewChallengeRegistry(handlers ...ChallengeHandler) *ChallengeRegistry {
+	r := &ChallengeRegistry{disabled: make(map[string]bool)}
+	for _, h := range handlers {
+		r.Register(h)
+	}
+	return r
+}
+
+// Register appends h to the registry. A handler with the same name is replaced in place.
+func (r *ChallengeRegistry) Register(h ChallengeHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := r.index(h.Name()); i >= 0 {
+		r.handlers[i] = h
+		return
+	}
+	r.handlers = append(r.handlers, h)
+}
+
+// RegisterBefore inserts h ahead of the handler called before, or appends it if
+// no such handler exists. A handler with the same name as h is removed first.
+func (r *ChallengeRegistry) RegisterBefore(before string, h ChallengeHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := r.index(h.Name()); i >= 0 {
+		r.handlers = append(r.handlers[:i], r.handlers[i+1:]...)
+	}
+	i := r.index(before)
+	if i < 0 {
+		r.handlers = append(r.handlers, h)
+		return
+	}
+	r.handlers = append(r.handlers[:i], append([]ChallengeHandler{h}, r.handlers[i:]...)...)
+}
+
+// Remove deletes the named handler and reports whether it was present.
+func (r *ChallengeRegistry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(name)
+	if i < 0 {
+		return false
+	}
+	r.handlers = append(r.handlers[:i], r.handlers[i+1:]...)
+	delete(r.disabled, name)
+	return true
+}
+
+// SetOrder moves the named handlers to the front of the registry in the given
+// order. Handlers not listed keep their relative order after them.
+func (r *ChallengeRegistry) SetOrder(names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ordered := make([]ChallengeHandler, 0, len(r.handlers))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		i := r.index(name)
+		if i < 0 {
+			return fmt.Errorf("unknown challenge handler %q", name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		ordered = append(ordered, r.handlers[i])
+	}
+	for _, h := range r.handlers {
+		if !seen[h.Name()] {
+			ordered = append(ordered, h)
+		}
+	}
+	r.handlers = ordered
+	return nil
+}
+
+// Disable keeps the named handler registered but skips it during detection.
+func (r *ChallengeRegistry) Disable(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disabled[name] = true
+}
+
+// Enable re-enables a handler previously disabled with Disable.
+func (r *ChallengeRegistry) Enable(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.disabled, name)
+}
+
+// Handlers returns the registered handlers in detection order, including disabled ones.
+func (r *ChallengeRegistry) Handlers() []ChallengeHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]ChallengeHandler(nil), r.handlers...)
+}
+
+// Match returns the first enabled handler that detects a challenge in resp, or nil.
+func (r *ChallengeRegistry) Match(resp *http.Response, body string) ChallengeHandler {
+	r.mu.RLock()
+	handlers := make([]ChallengeHandler, 0, len(r.handlers))
+	for _, h := range r.handlers {
+		if !r.disabled[h.Name()] {
+			handlers = append(handlers, h)
+		}
+	}
+	r.mu.RUnlock()
+
+	// Detection runs without the lock so that detectors may inspect the registry.
+	for _, h := range handlers {
+		if h.Detect(resp, body) {
+			return h
+		}
+	}
+	return nil
+}
+
+// index returns the position of the named handler, or -1. Callers must hold mu.
+func (r *ChallengeRegistry) index(name string) int {
+	for i, h := range r.handlers {
+		if h.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,74 @@
+package cloudscraper
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func namedHandler(name, marker string) ChallengeHandler {
+	return NewChallengeHandler(name, func(resp *http.Response, body string) bool {
+		return strings.Contains(body, marker)
+	}, func(c *Challenge) (*http.Response, error) {
+		return nil, nil
+	})
+}
+
+func handlerNames(r *ChallengeRegistry) []string {
+	var names []string
+	for _, h := range r.Handlers() {
+		names = append(names, h.Name())
+	}
+	return names
+}
+
+func TestChallengeRegistry_Order(t *testing.T) {
+	r := NewChallengeRegistry(namedHandler("a", "x"), namedHandler("b", "x"), namedHandler("c", "x"))
+
+	if got := r.Match(&http.Response{}, "x"); got == nil || got.Name() != "a" {
+		t.Fatalf("Match = %v, want a", got)
+	}
+	if err := r.SetOrder("c"); err != nil {
+		t.Fatalf("SetOrder: %v", err)
+	}
+	if got := strings.Join(handlerNames(r), ","); got != "c,a,b" {
+		t.Errorf("order after SetOrder = %s, want c,a,b", got)
+	}
+	r.RegisterBefore("a", namedHandler("d", "x"))
+	if got := strings.Join(handlerNames(r), ","); got != "c,d,a,b" {
+		t.Errorf("order after RegisterBefore = %s, want c,d,a,b", got)
+	}
+	if err := r.SetOrder("missing"); err == nil {
+		t.Error("SetOrder with an unknown handler should fail")
+	}
+}
+
+func TestChallengeRegistry_DisableAndRemove(t *testing.T) {
+	r := NewChallengeRegistry(namedHandler("a", "x"), namedHandler("b", "x"))
+
+	r.Disable("a")
+	if got := r.Match(&http.Response{}, "x"); got == nil || got.Name() != "b" {
+		t.Fatalf("Match with a disabled = %v, want b", got)
+	}
+	r.Enable("a")
+	if got := r.Match(&http.Response{}, "x"); got == nil || got.Name() != "a" {
+		t.Fatalf("Match after Enable = %v, want a", got)
+	}
+	if !r.Remove("a") || r.Remove("a") {
+		t.Error("Remove should succeed once")
+	}
+	if got := r.Match(&http.Response{}, "y"); got != nil {
+		t.Errorf("Match of an unrecognised body = %v, want nil", got.Name())
+	}
+}
+
+func TestNewScraper_CustomHandlersReplaceBuiltins(t *testing.T) {
+	s, err := New(WithChallengeHandlers(namedHandler("mine", "x"), namedHandler(HandlerJSV1, "x")))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	want := strings.Join([]string{"mine", HandlerJSV1, HandlerBlock, HandlerManaged, HandlerJSV2, HandlerCaptcha}, ",")
+	if got := strings.Join(handlerNames(s.Challenges), ","); got != want {
+		t.Errorf("handlers = %s, want %s", got, want)
+	}
+}
@@ -3,44 +3,60 @@ package cloudscraper
 import (
 	"fmt"
 	"log"
-	"regexp"
 	"strings"
 
 	"github.com/Advik-B/cloudscraper/lib/js"
 	"github.com/Advik-B/cloudscraper/lib/security"
 )
 
-// Regex to find and extract the modern challenge script content.
-var v2ScriptRegex = regexp.MustCompile(`(?s)<script[^>]*>(.*?window\._cf_chl_opt.*?)<\/script>`)
-
 // solveV2Logic solves modern v2/v3 challenges by delegating to the appropriate JS engine implementation.
-func solveV2Logic(body, domain string, engine js.Engine, logger *log.Logger) (string, error) {
-	scriptMatches := v2ScriptRegex.FindAllStringSubmatch(body, -1)
+// The returned result carries the engine's diagnostics and may be non-nil even when solving fails.
+func solveV2Logic(body, domain string, engine js.Engine, logger *log.Logger) (*js.Result, error) {
+	scriptMatches := parseChallengePage(body).chlOptScripts()
 	if len(scriptMatches) == 0 {
-		return "", fmt.Errorf("could not find modern JS challenge scripts")
+		return nil, fmt.Errorf("could not find modern JS challenge scripts")
 	}
 
 	// Security: Check total script size to prevent DoS
 	if err := security.ValidateTotalScriptSize(scriptMatches, security.MaxChallengeScriptSize); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Use a special synchronous path for Goja, which can't handle async setTimeout.
 	if gojaEngine, ok := engine.(*js.GojaEngine); ok {
-		return gojaEngine.SolveV2Challenge(body, domain, scriptMatches, logger)
+		return gojaEngine.SolveV2(body, domain, scriptMatches, logger)
 	}
 
 	// Use a modern asynchronous path for external runtimes (node, deno, bun).
 	return solveV2WithExternal(domain, scriptMatches, engine)
 }
 
+// logDiagnostics writes the console output and exceptions of a failed script execution to logger.
+func logDiagnostics(logger *log.Logger, res *js.Result) {
+	if res == nil {
+		return
+	}
+	for _, msg := range res.Console {
+		logger.Printf("js console.%s (block %d): %s\n", msg.Level, msg.Block, msg.Text())
+	}
+	for _, ex := range res.Exceptions {
+		logger.Printf("js exception (block %d): %s\n%s\n", ex.Block, ex.Message, ex.Stack)
+	}
+	for _, b := range res.Blocks {
+		logger.Printf("js block %d ran for %v\n", b.Block, b.Duration)
+	}
+	if len(res.ShimAccess) > 0 {
+		logger.Printf("js shim properties accessed: %s\n", strings.Join(res.ShimAccess, ", "))
+	}
+}
+
 // solveV2WithExternal builds a full script with shims and an async callback to solve the challenge.
-func solveV2WithExternal(domain string, scriptMatches [][]string, engine js.Engine) (string, error) {
+func solveV2WithExternal(domain string, scriptMatches [][]string, engine js.Engine) (*js.Result, error) {
 	// Security: Sanitize domain to prevent injection
 	safeDomain := security.SanitizeDomainForJS(domain)
 	if safeDomain == "" {
 		// Don't expose the original domain in error message for security
-		return "", fmt.Errorf("invalid domain: contains only filtered characters or is empty")
+		return nil, fmt.Errorf("invalid domain: contains only filtered characters or is empty")
 	}
 
 	// This DOM shim is required for the challenge script to run in a non-browser environment.
@@ -91,19 +107,24 @@ func solveV2WithExternal(domain string, scriptMatches [][]string, engine js.Engi
 		}
 	}
 
-	// The Cloudflare script uses a setTimeout of 4000ms. We'll wait a little longer
-	// and then extract the answer, printing it to stdout for Go to capture.
+	// Timers run on a virtual clock, so the Cloudflare script's setTimeout fires as
+	// soon as the queue is drained. The answer is then printed to stdout for Go to
+	// capture; the real delay is waited out by the caller before submitting.
 	answerExtractor := `
-        setTimeout(function() {
-            try {
-                var answer = document.getElementById('jschl-answer').value;
-                console.log(answer);
-            } catch (e) {
-                // Ignore errors if the element isn't found, the process will just exit.
-            }
-        }, 4100);
+        try {
+            console.log(document.getElementById('jschl-answer').value);
+        } catch (e) {
+            // Ignore errors if the element isn't found, the process will just exit.
+        }
     `
-	fullScript.WriteString(answerExtractor)
+	script := js.VirtualTimers(fullScript.String()) + answerExtractor
 
-	return engine.Run(fullScript.String())
+	if executor, ok := engine.(js.Executor); ok {
+		return executor.Execute(script)
+	}
+	answer, err := engine.Run(script)
+	if err != nil {
+		return nil, err
+	}
+	return &js.Result{Value: answer}, nil
 }
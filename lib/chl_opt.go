@@ -0,0 +1,90 @@
+package cloudscraper
+
+import (
+	"regexp"
+	"strings"
+)
+
+// chlOptFieldRegex matches the string and number fields of the _cf_chl_opt
+// object literal, e.g. cType: 'managed', cRay: "8a1b2c3d4e5f6a7b" or cTplV: 5.
+var chlOptFieldRegex = regexp.MustCompile(`([A-Za-z_$][\w$]*)\s*:\s*(?:'([^']*)'|"([^"]*)"|(-?\d+(?:\.\d+)?))`)
+
+// parseChlOpt extracts the top-level scalar fields of the window._cf_chl_opt
+// object that Cloudflare embeds in modern challenge pages. Nested objects such
+// as cRq are skipped. It returns nil when the page has no _cf_chl_opt.
+func parseChlOpt(body string) map[string]string {
+	literal := chlOptLiteral(body)
+	if literal == "" {
+		return nil
+	}
+
+	fields := make(map[string]string)
+	depth := 0
+	start := 0
+	// Only match fields at nesting depth 1, i.e. directly inside the outer braces.
+	for i := 0; i < len(literal); i++ {
+		switch literal[i] {
+		case '\'', '"':
+			// Skip string contents so braces inside strings don't affect depth.
+			if j := strings.IndexByte(literal[i+1:], literal[i]); j >= 0 {
+				i += j + 1
+			}
+		case '{':
+			if depth == 1 {
+				collectChlOptFields(literal[start:i], fields)
+			}
+			depth++
+			if depth == 1 {
+				start = i + 1
+			}
+		case '}':
+			depth--
+			if depth == 1 {
+				start = i + 1
+			}
+			if depth == 0 {
+				collectChlOptFields(literal[start:i], fields)
+			}
+		}
+	}
+	return fields
+}
+
+func collectChlOptFields(segment string, fields map[string]string) {
+	for _, m := range chlOptFieldRegex.FindAllStringSubmatch(segment, -1) {
+		if _, ok := fields[m[1]]; ok {
+			continue
+		}
+		fields[m[1]] = m[2] + m[3] + m[4]
+	}
+}
+
+// chlOptLiteral returns the `{...}` object literal assigned to _cf_chl_opt.
+func chlOptLiteral(body string) string {
+	loc := chlOptRegex.FindStringIndex(body)
+	if loc == nil {
+		return ""
+	}
+	rest := body[loc[1]:]
+	open := strings.IndexByte(rest, '{')
+	if open < 0 {
+		return ""
+	}
+	depth := 0
+	for i := open; i < len(rest); i++ {
+		switch rest[i] {
+		case '\'', '"':
+			if j := strings.IndexByte(rest[i+1:], rest[i]); j >= 0 {
+				i += j + 1
+			}
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return rest[open : i+1]
+			}
+		}
+	}
+	return ""
+}
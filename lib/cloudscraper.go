@@ -37,7 +37,9 @@ type Scraper struct {
 	CaptchaSolver captcha.Solver
 	ProxyManager  *proxy.Manager
 	StealthMode   *stealth.Mode
+	Challenges    *ChallengeRegistry
 	jsEngine      js.Engine
+	capture       *challengeCapturer
 
 	mu               sync.Mutex
 	sessionStartTime time.Time
@@ -60,7 +62,9 @@ func New(opts ...ScraperOption) (*Scraper, error) {
 			RandomizeHeaders: true,
 			BrowserQuirks:    true,
 		},
-		JSRuntime: js.Goja, // Default to the built-in Goja engine
+		JSRuntime:            js.Goja, // Default to the built-in Goja engine
+		ChallengeDelay:       ServerChallengeDelay,
+		MaxChallengeAttempts: DefaultMaxChallengeAttempts,
 	}
 
 	for _, opt := range opts {
@@ -96,8 +100,13 @@ func New(opts ...ScraperOption) (*Scraper, error) {
 		logger = log.New(io.Discard, "", 0)
 	}
 
+	if options.DeterministicJS != nil {
+		options.Goja.Deterministic = options.DeterministicJS
+		options.ExternalJS.Deterministic = options.DeterministicJS
+	}
+
 	var jsEngine js.Engine
-	
+
 	// Check if a custom engine was provided
 	if options.CustomJSEngine != nil {
 		jsEngine = options.CustomJSEngine
@@ -105,12 +114,12 @@ func New(opts ...ScraperOption) (*Scraper, error) {
 		// Use the configured runtime or default to Goja
 		switch options.JSRuntime {
 		case js.Node, js.Deno, js.Bun:
-			jsEngine, err = js.NewExternalEngine(string(options.JSRuntime))
+			jsEngine, err = js.NewExternalEngine(string(options.JSRuntime), options.ExternalJS)
 			if err != nil {
 				return nil, fmt.Errorf("failed to initialize JS runtime: %w", err)
 			}
 		case js.Goja, "": // Default to Goja
-			jsEngine = js.NewGojaEngine()
+			jsEngine = js.NewGojaEngine(options.Goja)
 		default:
 			return nil, fmt.Errorf("unsupported JS runtime: %s", options.JSRuntime)
 		}
@@ -130,7 +139,9 @@ func New(opts ...ScraperOption) (*Scraper, error) {
 		CaptchaSolver:    options.CaptchaSolver,
 		ProxyManager:     pm,
 		StealthMode:      stealth.New(options.Stealth),
+		Challenges:       newScraperRegistry(options.ChallengeHandlers),
 		jsEngine:         jsEngine,
+		capture:          newChallengeCapturer(options.Capture),
 		logger:           logger,
 		sessionStartTime: time.Now(),
 	}
@@ -157,6 +168,12 @@ func (s *Scraper) Post(url, contentType string, body io.Reader) (*http.Response,
 	return s.do(req)
 }
 
+// Do performs req. Cancelling the request's context also aborts any challenge
+// wait in progress.
+func (s *Scraper) Do(req *http.Request) (*http.Response, error) {
+	return s.do(req)
+}
+
 func (s *Scraper) do(req *http.Request) (*http.Response, error) {
 	return s.doWithRefresh(req, true)
 }
@@ -228,9 +245,8 @@ func (s *Scraper) doWithRefresh(req *http.Request, allowRefresh bool) (*http.Res
 	}
 	resp.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
 
-	if isChallengeResponse(resp, bodyBytes) {
-		s.logger.Println("Cloudflare protection detected, attempting to bypass...")
-		return s.handleChallenge(resp, allowRefresh)
+	if h := s.Challenges.Match(resp, string(bodyBytes)); h != nil {
+		return s.handleChallenge(req.Context(), h, resp, string(bodyBytes), currentProxy, allowRefresh)
 	}
 
 	if resp.StatusCode == http.StatusForbidden && s.opts.AutoRefreshOn403 && allowRefresh {
@@ -242,7 +258,9 @@ func (s *Scraper) doWithRefresh(req *http.Request, allowRefresh bool) (*http.Res
 		if err != nil {
 			return resp, nil
 		}
-		redirectReq, _ := http.NewRequest("GET", loc.String(), nil)
+		// Keep the context so that a challenge behind the redirect counts against
+		// the same attempt budget.
+		redirectReq, _ := http.NewRequestWithContext(req.Context(), "GET", loc.String(), nil)
 		return s.doWithRefresh(redirectReq, allowRefresh)
 	}
 
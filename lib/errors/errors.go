@@ -1,13 +1,126 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 var (
 	ErrCloudflare         = errors.New("cloudflare error")
 	ErrChallenge          = errors.New("challenge error")
 	ErrUnknownChallenge   = errors.New("unknown cloudflare challenge")
 	ErrChallengeTimeout   = errors.New("challenge solving timeout")
+	ErrScriptTimeout      = errors.New("script execution timeout")
 	ErrNoCaptchaSolver    = errors.New("captcha provider not configured")
 	ErrAllProxiesBanned   = errors.New("all proxies are currently banned")
 	ErrMaxRetriesExceeded = errors.New("failed after max retries")
+	ErrBlocked            = errors.New("request blocked by cloudflare")
+	ErrAccessDenied       = errors.New("access denied by firewall rule (error 1020)")
+	ErrRateLimited        = errors.New("rate limited (error 1015)")
+	ErrBrowserBanned      = errors.New("browser signature banned (error 1010)")
+	ErrChallengeLoop      = errors.New("cloudflare kept re-issuing the challenge")
+	ErrCaptchaBudget      = errors.New("captcha budget exceeded")
+)
+
+// ChallengeAttempt describes one challenge page met while serving a request.
+type ChallengeAttempt struct {
+	Kind       string
+	URL        string
+	StatusCode int
+	RayID      string
+	// CRay and Pass identify the challenge instance: the cRay of _cf_chl_opt,
+	// or the pass field of a classic challenge form.
+	CRay string
+	Pass string
+}
+
+// ChallengeError describes a Cloudflare challenge or block page that could not
+// be passed. It wraps one of the sentinel errors above, or the error returned by
+// the solver, and carries the page metadata needed to group failures.
+// Use errors.As to retrieve it.
+type ChallengeError struct {
+	// Kind is the challenge classification, e.g. "managed" or "access-denied".
+	Kind string
+	// RayID is the value of the cf-ray response header.
+	RayID      string
+	StatusCode int
+	URL        string
+	// CType, CRay and CZone are copied from the page's _cf_chl_opt object, when present.
+	CType string
+	CRay  string
+	CZone string
+	// Attempts is the number of challenges met while serving the request.
+	Attempts int
+	// History lists those challenges in order, the failed one last.
+	History []ChallengeAttempt
+	// Solver names the handler and engine or captcha provider that failed.
+	Solver string
+	Err    error
+}
+
+func (e *ChallengeError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cloudflare %s challenge failed", e.Kind)
+	var details []string
+	if e.Solver != "" {
+		details = append(details, "solver "+e.Solver)
+	}
+	if e.StatusCode != 0 {
+		details = append(details, fmt.Sprintf("status %d", e.StatusCode))
+	}
+	if e.RayID != "" {
+		details = append(details, "ray "+e.RayID)
+	}
+	if e.Attempts > 1 {
+		details = append(details, fmt.Sprintf("%d attempts", e.Attempts))
+	}
+	if e.URL != "" {
+		details = append(details, e.URL)
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(details, ", "))
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+func (e *ChallengeError) Unwrap() error {
+	return e.Err
+}
+
+// Limits of a captcha budget, see BudgetError.
+const (
+	BudgetHostRate = "host-rate"
+	BudgetSpend    = "spend"
 )
+
+// BudgetError is returned instead of solving a captcha that would exceed the
+// configured budget. It wraps ErrCaptchaBudget; use errors.As to retrieve it.
+type BudgetError struct {
+	// Limit is the limit that was reached: BudgetHostRate or BudgetSpend.
+	Limit string
+	// Host is the host the captcha was served by.
+	Host string
+	// Used and Max are the solves in the last hour for BudgetHostRate, or the
+	// amounts spent and allowed for BudgetSpend.
+	Used float64
+	Max  float64
+	// RetryAfter is when the host rate allows another solve; zero for BudgetSpend.
+	RetryAfter time.Duration
+}
+
+func (e *BudgetError) Error() string {
+	if e.Limit == BudgetHostRate {
+		return fmt.Sprintf("%v: %.0f of %.0f solves per hour used for %s, retry in %s",
+			ErrCaptchaBudget, e.Used, e.Max, e.Host, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("%v: spent %.4f of %.4f", ErrCaptchaBudget, e.Used, e.Max)
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrCaptchaBudget
+}
@@ -0,0 +1,96 @@
+package js
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDeterministicTime is the start of the virtual clock when Deterministic.Now is zero.
+var DefaultDeterministicTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Deterministic pins the sources of nondeterminism a challenge script can observe
+// (Math.random, Date and performance.now), so that replaying a captured challenge
+// page produces the same answer on every run.
+type Deterministic struct {
+	// Seed initialises the Math.random generator.
+	Seed int64
+	// Now is the instant the virtual clock starts at. Defaults to DefaultDeterministicTime.
+	Now time.Time
+	// Tick is how far the virtual clock advances each time it is read.
+	// Zero freezes the clock.
+	Tick time.Duration
+}
+
+func (d *Deterministic) start() time.Time {
+	if d.Now.IsZero() {
+		return DefaultDeterministicTime
+	}
+	return d.Now
+}
+
+// mulberry32 is a small seeded PRNG. The same algorithm is used by the JS prelude
+// of external runtimes, so goja and node/deno/bun produce identical sequences.
+type mulberry32 struct {
+	state uint32
+}
+
+func (m *mulberry32) Float64() float64 {
+	m.state += 0x6D2B79F5
+	a := m.state
+	t := (a ^ a>>15) * (1 | a)
+	t = (t + (t^t>>7)*(61|t)) ^ t
+	return float64(t^t>>14) / 4294967296
+}
+
+// virtualClock returns a fixed start time, advanced by tick on every read.
+type virtualClock struct {
+	mu    sync.Mutex
+	start time.Time
+	tick  time.Duration
+	reads int64
+}
+
+func (c *virtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.start.Add(time.Duration(c.reads) * c.tick)
+	c.reads++
+	return t
+}
+
+// elapsed reports the virtual time since the clock started, in milliseconds.
+func (c *virtualClock) elapsed() float64 {
+	return float64(c.Now().Sub(c.start)) / float64(time.Millisecond)
+}
+
+// deterministicPrelude returns a script that installs the same seeded Math.random,
+// virtual Date and fixed performance.now in an external runtime.
+func deterministicPrelude(d *Deterministic) string {
+	return fmt.Sprintf(`(function() {
+	var state = %d >>> 0;
+	Math.random = function() {
+		state = (state + 0x6D2B79F5) >>> 0;
+		var t = Math.imul(state ^ state >>> 15, 1 | state);
+		t = (t + Math.imul(t ^ t >>> 7, 61 | t)) ^ t;
+		return ((t ^ t >>> 14) >>> 0) / 4294967296;
+	};
+	var start = %d, tick = %g, reads = 0;
+	function now() { return start + tick * reads++; }
+	var RealDate = Date;
+	function VirtualDate() {
+		if (!new.target) return new RealDate(now()).toString();
+		return Reflect.construct(RealDate, arguments.length ? Array.prototype.slice.call(arguments) : [now()], new.target);
+	}
+	Object.setPrototypeOf(VirtualDate, RealDate);
+	VirtualDate.prototype = RealDate.prototype;
+	VirtualDate.now = now;
+	globalThis.Date = VirtualDate;
+	Object.defineProperty(globalThis, 'performance', {
+		value: { now: function() { return now() - start; } },
+		writable: true,
+		configurable: true
+	});
+})();
+`, uint32(d.Seed), d.start().UnixMilli(), float64(d.Tick)/float64(time.Millisecond))
+}
@@ -0,0 +1,59 @@
+package js
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+const deterministicProbe = `console.log([Math.random(), Math.random(), Date.now(), new Date().getTime(), performance.now()].join(','))`
+
+func TestGojaEngine_Deterministic(t *testing.T) {
+	d := &Deterministic{Seed: 42, Tick: time.Millisecond}
+	e := NewGojaEngine(GojaOptions{Deterministic: d, PoolSize: 1})
+
+	first, err := e.Run(deterministicProbe)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	second, err := e.Run(deterministicProbe)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if first != second {
+		t.Errorf("deterministic runs differ:\n%s\n%s", first, second)
+	}
+
+	other, err := NewGojaEngine(GojaOptions{Deterministic: &Deterministic{Seed: 7}}).Run(deterministicProbe)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if other == first {
+		t.Errorf("different seeds produced the same output %q", first)
+	}
+}
+
+// TestDeterministic_ExternalMatchesGoja asserts that the JS prelude used by
+// external runtimes reproduces the goja sequence exactly.
+func TestDeterministic_ExternalMatchesGoja(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not found in PATH")
+	}
+	d := &Deterministic{Seed: 1234, Now: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC), Tick: 5 * time.Millisecond}
+
+	want, err := NewGojaEngine(GojaOptions{Deterministic: d}).Run(deterministicProbe)
+	if err != nil {
+		t.Fatalf("goja Run: %v", err)
+	}
+	node, err := NewExternalEngine("node", ExternalOptions{Deterministic: d})
+	if err != nil {
+		t.Fatalf("NewExternalEngine: %v", err)
+	}
+	got, err := node.Run(deterministicProbe)
+	if err != nil {
+		t.Fatalf("node Run: %v", err)
+	}
+	if got != want {
+		t.Errorf("node = %q, goja = %q", got, want)
+	}
+}
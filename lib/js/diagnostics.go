@@ -0,0 +1,117 @@
+package js
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Console levels captured from scripts.
+const (
+	LevelLog   = "log"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+	LevelDebug = "debug"
+)
+
+var consoleLevels = []string{LevelLog, LevelInfo, LevelWarn, LevelError, LevelDebug}
+
+// ConsoleMessage is a single console call made by a script.
+type ConsoleMessage struct {
+	Level string
+	Args  []string
+	// Block is the index of the script block that made the call.
+	Block int
+}
+
+// Text joins the arguments the way a browser console displays them.
+func (m ConsoleMessage) Text() string {
+	return strings.Join(m.Args, " ")
+}
+
+// ScriptError is an exception thrown by a script block.
+type ScriptError struct {
+	Block   int
+	Message string
+	// Stack is the JS stack trace, one frame per line, when the engine provides one.
+	Stack string
+}
+
+// BlockTiming records how long a single script block took to execute.
+type BlockTiming struct {
+	Block    int
+	Duration time.Duration
+}
+
+// Result is the structured outcome of a script execution.
+type Result struct {
+	// Value is what Run returns: console output for plain scripts, or the
+	// challenge answer for SolveV2.
+	Value      string
+	Console    []ConsoleMessage
+	Exceptions []ScriptError
+	Blocks     []BlockTiming
+	// ShimAccess lists the DOM shim properties read by the scripts, e.g.
+	// "document.getElementById". Only engines with a built-in shim report it.
+	ShimAccess []string
+	Duration   time.Duration
+}
+
+// Executor is implemented by engines that report structured diagnostics in
+// addition to the plain output returned by Engine.Run.
+type Executor interface {
+	Execute(script string) (*Result, error)
+}
+
+// scriptError converts an error returned by goja into a ScriptError.
+func scriptError(block int, err error) ScriptError {
+	se := ScriptError{Block: block, Message: err.Error()}
+	var ex *goja.Exception
+	if errors.As(err, &ex) {
+		if v := ex.Value(); v != nil {
+			se.Message = v.String()
+		}
+		var b bytes.Buffer
+		for _, frame := range ex.Stack() {
+			frame.Write(&b)
+			b.WriteByte('\n')
+		}
+		se.Stack = strings.TrimRight(b.String(), "\n")
+	}
+	return se
+}
+
+// trackShimScript wraps the DOM shim objects in proxies that report every
+// property read to the given callback. It is run after the shim is installed.
+const trackShimScript = `(function(record) {
+	['document', 'navigator'].forEach(function(name) {
+		var target = globalThis[name];
+		if (target === null || typeof target !== 'object') return;
+		globalThis[name] = new Proxy(target, {
+			get: function(t, prop, receiver) {
+				if (typeof prop === 'string') record(name + '.' + prop);
+				return Reflect.get(t, prop, receiver);
+			}
+		});
+	});
+})`
+
+// accessSet collects the distinct shim properties read during an execution.
+type accessSet map[string]struct{}
+
+func (a accessSet) sorted() []string {
+	if len(a) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
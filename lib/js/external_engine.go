@@ -2,55 +2,190 @@ package js
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Advik-B/cloudscraper/lib/security"
 )
 
+// versionProbeTimeout bounds the `--version` call made when an engine is created.
+const versionProbeTimeout = 10 * time.Second
+
+// ExternalOptions configures how an external runtime is located and invoked.
+type ExternalOptions struct {
+	// Path is an explicit path to the runtime binary. When empty, the runtime
+	// is looked up in PATH. The binary's name must still match the runtime.
+	Path string
+	// Module selects CommonJS or ES module mode. Defaults to the runtime's own default.
+	Module ModuleMode
+	// SkipVersionCheck disables the `--version` probe against Profile.MinVersion.
+	SkipVersionCheck bool
+	// Deterministic, when set, prepends a prelude that seeds Math.random and
+	// replaces Date and performance.now with a virtual clock.
+	Deterministic *Deterministic
+}
+
 // ExternalEngine uses an external command-line JS runtime (node, deno, bun).
 type ExternalEngine struct {
 	Command string
+	// Path is the resolved location of the runtime binary.
+	Path string
+	// Args are the arguments passed to the runtime so it executes stdin.
+	Args []string
+	// Version is the runtime version reported by `--version`, if it was probed.
+	Version string
+	// Deterministic, when set, makes every Run start from the same seed and instant.
+	Deterministic *Deterministic
 }
 
 // NewExternalEngine creates a new engine that shells out to an external command.
-func NewExternalEngine(command string) (*ExternalEngine, error) {
+// An optional ExternalOptions may be passed to select an explicit binary or module mode.
+func NewExternalEngine(command string, opts ...ExternalOptions) (*ExternalEngine, error) {
+	var o ExternalOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
 	// Security: Only allow known, safe commands to be executed to prevent command injection.
-	switch command {
-	case "node", "deno", "bun":
-		// This is a supported and expected runtime.
-	default:
+	profile, ok := ProfileFor(Runtime(command))
+	if !ok {
 		return nil, fmt.Errorf("unsupported or unsafe external JS runtime: '%s'", command)
 	}
 
-	// Check if the command exists in the system's PATH.
-	if _, err := exec.LookPath(command); err != nil {
-		return nil, fmt.Errorf("javascript runtime '%s' not found in PATH: %w", command, err)
+	args, err := profile.Command(o.Module)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := resolveRuntimePath(command, o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &ExternalEngine{Command: command, Path: path, Args: args, Deterministic: o.Deterministic}
+	if !o.SkipVersionCheck {
+		if err := e.checkVersion(profile.MinVersion); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// resolveRuntimePath finds the binary for command, either in PATH or at the explicit path.
+func resolveRuntimePath(command, explicit string) (string, error) {
+	if explicit == "" {
+		// Check if the command exists in the system's PATH.
+		path, err := exec.LookPath(command)
+		if err != nil {
+			return "", fmt.Errorf("javascript runtime '%s' not found in PATH: %w", command, err)
+		}
+		return path, nil
+	}
+
+	// Security: An explicit path is still restricted to the allow-listed runtime,
+	// so it cannot be used to execute an arbitrary binary.
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(explicit)), ".exe")
+	if name != command {
+		return "", fmt.Errorf("javascript runtime path '%s' does not point to a '%s' binary", explicit, command)
+	}
+	path, err := exec.LookPath(filepath.Clean(explicit))
+	if err != nil {
+		return "", fmt.Errorf("javascript runtime '%s' not found at '%s': %w", command, explicit, err)
 	}
-	return &ExternalEngine{Command: command}, nil
+	return path, nil
+}
+
+// checkVersion runs `<runtime> --version` and compares the result against min.
+func (e *ExternalEngine) checkVersion(min string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, e.Path, "--version").Output()
+	if err != nil {
+		return fmt.Errorf("javascript runtime '%s' version check failed: %w", e.Command, err)
+	}
+	e.Version = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	have, ok := parseVersion(e.Version)
+	if !ok {
+		return fmt.Errorf("javascript runtime '%s' reported an unrecognised version: %q", e.Command, e.Version)
+	}
+	want, _ := parseVersion(min)
+	if !versionAtLeast(have, want) {
+		return fmt.Errorf("javascript runtime '%s' version %s is older than the required %s", e.Command, e.Version, min)
+	}
+	return nil
 }
 
 // Run executes a script by piping it to the external runtime's stdin.
 func (e *ExternalEngine) Run(script string) (string, error) {
+	res, err := e.Execute(script)
+	if err != nil {
+		return "", err
+	}
+	return res.Value, nil
+}
+
+// Execute runs a script like Run and returns the structured diagnostics of the
+// execution. External runtimes only expose their output streams, so stdout lines
+// are reported at LevelLog, stderr lines at LevelError, and a failing run is
+// reported as a single exception carrying stderr.
+func (e *ExternalEngine) Execute(script string) (*Result, error) {
 	// Security: Check script size to prevent DoS attacks
 	if err := security.ValidateScriptSize(script, security.MaxExternalScriptSize); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Security: The `e.Command` field is sanitized in the constructor (NewExternalEngine),
-	// making this call safe from command injection.
-	cmd := exec.Command(e.Command)
+	// Security: `e.Path` and `e.Args` are derived from the allow-listed profile in the
+	// constructor (NewExternalEngine), making this call safe from command injection.
+	path, args := e.Path, e.Args
+	if path == "" {
+		// Engines built as struct literals fall back to the bare command.
+		path = e.Command
+	}
+	if e.Deterministic != nil {
+		script = deterministicPrelude(e.Deterministic) + script
+	}
+	cmd := exec.Command(path, args...)
 	cmd.Stdin = strings.NewReader(script)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
+	start := time.Now()
 	err := cmd.Run()
+	res := &Result{
+		Value:    strings.TrimSpace(stdout.String()),
+		Duration: time.Since(start),
+	}
+	res.Blocks = []BlockTiming{{Block: 0, Duration: res.Duration}}
+	res.Console = append(streamMessages(LevelLog, stdout.String()), streamMessages(LevelError, stderr.String())...)
+
 	if err != nil {
-		return "", fmt.Errorf("external js runtime '%s' failed with exit error: %w. Stderr: %s", e.Command, err, stderr.String())
+		message, stack, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		if message == "" {
+			message = err.Error()
+		}
+		res.Exceptions = []ScriptError{{Block: 0, Message: message, Stack: stack}}
+		return res, fmt.Errorf("external js runtime '%s' failed with exit error: %w. Stderr: %s", e.Command, err, stderr.String())
 	}
 
-	return strings.TrimSpace(stdout.String()), nil
+	return res, nil
+}
+
+// streamMessages splits the output of a runtime into one console message per line.
+func streamMessages(level, output string) []ConsoleMessage {
+	var msgs []ConsoleMessage
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		msgs = append(msgs, ConsoleMessage{Level: level, Args: []string{line}})
+	}
+	return msgs
 }
@@ -2,11 +2,13 @@ package js
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
+	cserrors "github.com/Advik-B/cloudscraper/lib/errors"
 	"github.com/Advik-B/cloudscraper/lib/security"
 	"github.com/dop251/goja"
 )
@@ -16,110 +18,283 @@ import (
 //go:embed setup.js
 var setupScript string
 
+// DefaultGojaTimeout is the execution timeout used when GojaOptions.Timeout is zero.
+const DefaultGojaTimeout = 3 * time.Second
+
+// GojaOptions configures the sandbox applied to every VM a GojaEngine creates.
+type GojaOptions struct {
+	// Timeout bounds a single Run or SolveV2Challenge call. Defaults to DefaultGojaTimeout.
+	Timeout time.Duration
+	// MaxCallStackSize limits the JS call depth. Zero keeps goja's default.
+	MaxCallStackSize int
+	// MaxIterations interrupts an execution once its scripts have run this many
+	// loop iterations and function calls, counted per VM. Zero disables it.
+	MaxIterations int
+	// FrozenGlobals are deep-frozen and made read-only before any script runs.
+	FrozenGlobals []string
+	// RemovedGlobals are deleted from the global object before any script runs.
+	RemovedGlobals []string
+	// Deterministic, when set, seeds Math.random and replaces the clock seen by
+	// Date and performance.now with a virtual one, making executions reproducible.
+	Deterministic *Deterministic
+	// PoolSize is the number of idle runtimes kept for reuse between executions.
+	// Zero selects GOMAXPROCS; a negative value disables pooling.
+	PoolSize int
+}
+
 // GojaEngine uses the embedded goja interpreter.
-type GojaEngine struct{}
+type GojaEngine struct {
+	opts GojaOptions
+	pool *gojaPool
+}
 
 // NewGojaEngine creates a new engine that uses the built-in goja interpreter.
-func NewGojaEngine() *GojaEngine {
-	return &GojaEngine{}
+// An optional GojaOptions may be passed to configure the sandbox.
+func NewGojaEngine(opts ...GojaOptions) *GojaEngine {
+	var o GojaOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultGojaTimeout
+	}
+	return &GojaEngine{opts: o, pool: newGojaPool(o.PoolSize)}
 }
 
-// Run executes a script in goja. It captures output by overriding console.log.
-func (e *GojaEngine) Run(script string) (string, error) {
-	// Security: Check script size to prevent DoS attacks
-	if err := security.ValidateScriptSize(script, security.MaxGojaScriptSize); err != nil {
-		return "", err
+// timeout returns the configured execution timeout, falling back to the default
+// for engines that were not built with NewGojaEngine.
+func (e *GojaEngine) timeout() time.Duration {
+	if e.opts.Timeout <= 0 {
+		return DefaultGojaTimeout
 	}
+	return e.opts.Timeout
+}
 
-	vm := goja.New()
-	var result string
+// freezeGlobalsScript deep-freezes the named globals and makes their bindings read-only.
+const freezeGlobalsScript = `(function(names) {
+	var seen = [];
+	function deepFreeze(o) {
+		if (o === null || (typeof o !== 'object' && typeof o !== 'function') || seen.indexOf(o) >= 0) return;
+		seen.push(o);
+		Object.getOwnPropertyNames(o).forEach(function(k) {
+			var d = Object.getOwnPropertyDescriptor(o, k);
+			if (d && 'value' in d) deepFreeze(d.value);
+		});
+		Object.freeze(o);
+	}
+	for (var i = 0; i < names.length; i++) {
+		if (!(names[i] in globalThis)) continue;
+		deepFreeze(globalThis[names[i]]);
+		Object.defineProperty(globalThis, names[i], { writable: false });
+	}
+})`
 
-	// Setup safe console.log capturing
-	console := vm.NewObject()
-	console.Set("log", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) > 0 {
-			result = call.Arguments[0].String()
+// harden removes and freezes the configured globals. It must run after the
+// environment (console, DOM shim) is installed and before untrusted code.
+// The DOM shim declares its globals with var, which cannot be deleted; removing
+// one of them sets it to undefined instead.
+func (e *GojaEngine) harden(vm *goja.Runtime) error {
+	global := vm.GlobalObject()
+	for _, name := range e.opts.RemovedGlobals {
+		if global.Delete(name) == nil {
+			continue
 		}
-		return goja.Undefined()
-	})
-	vm.Set("console", console)
+		if err := global.Set(name, goja.Undefined()); err != nil {
+			return fmt.Errorf("goja: failed to remove global %q: %w", name, err)
+		}
+	}
+	if len(e.opts.FrozenGlobals) == 0 {
+		return nil
+	}
 
-	// === Hardened Execution ===
-	const maxExecutionTime = 3 * time.Second
-	done := make(chan struct{})
-	var execErr error
+	fn, err := vm.RunProgram(freezeGlobalsProgram)
+	if err != nil {
+		return fmt.Errorf("goja: failed to compile freeze helper: %w", err)
+	}
+	freeze, _ := goja.AssertFunction(fn)
+	if _, err := freeze(goja.Undefined(), vm.ToValue(e.opts.FrozenGlobals)); err != nil {
+		return fmt.Errorf("goja: failed to freeze globals: %w", err)
+	}
+	return nil
+}
 
-	// Run the script in a goroutine with timeout
+// guard runs fn while enforcing the execution timeout on vm. The iteration
+// budget is enforced by the instrumented scripts themselves.
+// fn may call into the VM any number of times; the timeout applies to the whole call.
+// A runtime that was interrupted or panicked is marked as tainted.
+func (e *GojaEngine) guard(vm *gojaVM, fn func() error) (err error) {
+	stop := make(chan struct{})
+	watchdogDone := make(chan struct{})
 	go func() {
-		defer close(done)
-		defer func() {
-			if r := recover(); r != nil {
-				execErr = fmt.Errorf("goja: panic during execution: %v", r)
-			}
-		}()
-		
-		_, execErr = vm.RunString(script)
+		defer close(watchdogDone)
+		e.watch(vm.rt, stop)
 	}()
 
-	// Wait for completion or timeout
-	timer := time.NewTimer(maxExecutionTime)
+	defer func() {
+		if r := recover(); r != nil {
+			vm.tainted = true
+			err = fmt.Errorf("goja: panic during execution: %v", r)
+		}
+		// Wait for the watchdog so that no late Interrupt can leak into the next run.
+		close(stop)
+		<-watchdogDone
+		vm.rt.ClearInterrupt()
+	}()
+
+	err = fn()
+
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		vm.tainted = true
+		switch interrupted.Value() {
+		case cserrors.ErrScriptTimeout:
+			return fmt.Errorf("goja: script execution timed out after %v: %w", e.timeout(), cserrors.ErrScriptTimeout)
+		case errIterationBudget:
+			return fmt.Errorf("goja: script exceeded the iteration budget of %d", e.opts.MaxIterations)
+		}
+	}
+	return err
+}
+
+// watch interrupts vm once the timeout elapses. It returns when stop is closed.
+func (e *GojaEngine) watch(vm *goja.Runtime, stop <-chan struct{}) {
+	timer := time.NewTimer(e.timeout())
 	defer timer.Stop()
-	
+
 	select {
-	case <-done:
-		if execErr != nil {
-			return "", fmt.Errorf("goja: script execution failed: %w", execErr)
-		}
-		return result, nil
+	case <-stop:
 	case <-timer.C:
-		vm.Interrupt("execution timeout")
-		<-done // Wait for goroutine to finish
-		return "", fmt.Errorf("goja: script execution timed out after %v", maxExecutionTime)
+		vm.Interrupt(cserrors.ErrScriptTimeout)
 	}
 }
 
-// SolveV2Challenge uses the original synchronous method to solve v2 challenges,
-// as goja does not support asynchronous operations like setTimeout without additional setup.
+// Run executes a script in goja. It captures output by overriding console.log.
+func (e *GojaEngine) Run(script string) (string, error) {
+	res, err := e.Execute(script)
+	if err != nil {
+		return "", err
+	}
+	return res.Value, nil
+}
+
+// Execute runs a script like Run and returns the structured diagnostics of the
+// execution. Value holds the first argument of the last console.log call.
+// On failure the partial result is returned alongside the error.
+func (e *GojaEngine) Execute(script string) (*Result, error) {
+	// Security: Check script size to prevent DoS attacks
+	if err := security.ValidateScriptSize(script, security.MaxGojaScriptSize); err != nil {
+		return nil, err
+	}
+
+	vm, err := e.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer e.release(vm)
+	res := vm.diag
+
+	// === Hardened Execution ===
+	start := time.Now()
+	err = e.guard(vm, func() error {
+		_, err := vm.rt.RunString(e.instrument(script))
+		return err
+	})
+	res.Duration = time.Since(start)
+	res.Blocks = []BlockTiming{{Block: 0, Duration: res.Duration}}
+	res.ShimAccess = vm.access.sorted()
+	res.Value = vm.lastLog
+	if err != nil {
+		res.Exceptions = append(res.Exceptions, scriptError(0, err))
+		if errors.Is(err, cserrors.ErrScriptTimeout) {
+			return res, err
+		}
+		return res, fmt.Errorf("goja: script execution failed: %w", err)
+	}
+	return res, nil
+}
+
+// SolveV2Challenge solves a v2 challenge synchronously. Timers scheduled by the
+// challenge scripts run on a virtual clock, so the call does not sleep.
 func (e *GojaEngine) SolveV2Challenge(body, domain string, scriptMatches [][]string, logger *log.Logger) (string, error) {
+	res, err := e.SolveV2(body, domain, scriptMatches, logger)
+	if err != nil {
+		return "", err
+	}
+	return res.Value, nil
+}
+
+// SolveV2 solves a v2 challenge like SolveV2Challenge and returns the structured
+// diagnostics of every script block, with the answer in Value. On failure the
+// partial result is returned alongside the error.
+func (e *GojaEngine) SolveV2(body, domain string, scriptMatches [][]string, logger *log.Logger) (*Result, error) {
 	// Security: Check total script size
 	if err := security.ValidateTotalScriptSize(scriptMatches, security.MaxGojaScriptSize); err != nil {
-		return "", fmt.Errorf("goja: %w", err)
+		return nil, fmt.Errorf("goja: %w", err)
 	}
 
-	vm := goja.New()
-
-	// Security: Running setup script in VM.
-	if _, err := vm.RunString(setupScript); err != nil {
-		return "", fmt.Errorf("goja: failed to set up DOM shim: %w", err)
+	vm, err := e.acquire()
+	if err != nil {
+		return nil, err
 	}
+	defer e.release(vm)
+	res := vm.diag
+
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start)
+	}()
 
-	// Execute all extracted Cloudflare scripts in the same VM context.
-	for _, match := range scriptMatches {
-		if len(match) > 1 {
-			scriptContent := match[1]
-			scriptContent = strings.ReplaceAll(scriptContent, `document.getElementById('challenge-form');`, "({})")
-			// Security: This executes JavaScript from the Cloudflare challenge page.
-			// The goja VM is sandboxed, but this is an inherent risk of the library's function.
-			if _, err := vm.RunString(scriptContent); err != nil {
-				logger.Printf("goja: warning, a script block failed to run: %v\n", err)
+	err = e.guard(vm, func() error {
+		// Execute all extracted Cloudflare scripts in the same VM context.
+		for i, match := range scriptMatches {
+			if len(match) > 1 {
+				vm.block = i
+				scriptContent := match[1]
+				scriptContent = strings.ReplaceAll(scriptContent, `document.getElementById('challenge-form');`, "({})")
+				// Security: This executes JavaScript from the Cloudflare challenge page.
+				// The goja VM is sandboxed, but this is an inherent risk of the library's function.
+				blockStart := time.Now()
+				_, err := vm.rt.RunString(e.instrument(scriptContent))
+				res.Blocks = append(res.Blocks, BlockTiming{Block: i, Duration: time.Since(blockStart)})
+				if err != nil {
+					res.Exceptions = append(res.Exceptions, scriptError(i, err))
+					var interrupted *goja.InterruptedError
+					if errors.As(err, &interrupted) {
+						return err
+					}
+					logger.Printf("goja: warning, script block %d failed to run: %v\n", i, err)
+				}
 			}
 		}
+		// Run the callbacks the scripts scheduled with setTimeout on the virtual
+		// clock. The caller waits out the real delay before submitting.
+		vm.block = len(scriptMatches)
+		_, err := vm.rt.RunString(fmt.Sprintf("__drainTimers(%d)", MaxTimerRuns))
+		return err
+	})
+	// Snapshot before the answer is read back, so only the challenge's own reads are listed.
+	res.ShimAccess = vm.access.sorted()
+	if err != nil {
+		return res, err
 	}
 
-	// Wait for the script's internal timeouts to complete.
-	time.Sleep(4 * time.Second)
-
 	// Get the final answer from the 'jschl_answer' field in the dummy document.
 	// Security: This executes a small, controlled script to retrieve a value.
-	answerVal, err := vm.RunString(`document.getElementById('jschl-answer').value`)
+	var answerVal goja.Value
+	err = e.guard(vm, func() error {
+		var err error
+		answerVal, err = vm.rt.RunString(`document.getElementById('jschl-answer').value`)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("goja: could not retrieve final answer from VM: %w", err)
+		return res, fmt.Errorf("goja: could not retrieve final answer from VM: %w", err)
 	}
 
 	answer := answerVal.String()
 	if answer == "" || answer == "undefined" {
-		return "", fmt.Errorf("goja: answer value is empty or undefined")
+		return res, fmt.Errorf("goja: answer value is empty or undefined")
 	}
 
-	return answer, nil
+	res.Value = answer
+	return res, nil
 }
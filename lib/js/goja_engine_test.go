@@ -0,0 +1,229 @@
+package js
+
+import (
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	cserrors "github.com/Advik-B/cloudscraper/lib/errors"
+)
+
+func TestGojaEngine_Run(t *testing.T) {
+	out, err := NewGojaEngine().Run(`console.log((1 + 2).toFixed(10))`)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if out != "3.0000000000" {
+		t.Errorf("Run = %q, want %q", out, "3.0000000000")
+	}
+}
+
+func TestGojaEngine_Timeout(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	_, err := e.Run(`for (;;) {}`)
+	if !errors.Is(err, cserrors.ErrScriptTimeout) {
+		t.Fatalf("Run error = %v, want ErrScriptTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout took %v to fire", elapsed)
+	}
+}
+
+func TestGojaEngine_MaxCallStackSize(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{MaxCallStackSize: 64})
+	if _, err := e.Run(`function f(n) { return f(n + 1); } f(0);`); err == nil {
+		t.Fatal("expected unbounded recursion to fail")
+	}
+}
+
+func TestGojaEngine_MaxIterations(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{MaxIterations: 1000, PoolSize: 1})
+	for _, script := range []string{
+		`for (;;) {}`,
+		`while (true) ;`,
+		`function f() { f(); } try { f(); } catch (e) {} for (;;) {}`,
+	} {
+		_, err := e.Run(script)
+		if err == nil || !strings.Contains(err.Error(), "iteration budget") {
+			t.Errorf("Run(%q) error = %v, want the iteration budget", script, err)
+		}
+	}
+
+	// The budget is per execution, and instrumentation keeps the semantics.
+	out, err := e.Run(`
+		function strict() { "use strict"; return this === undefined; }
+		var n = 0, i = 0;
+		do n++; while (n < 300)
+		outer: for (i = 0; i < 10; i++) for (var j = 0; j < 10; j++) { if (j > 4) continue outer; n++; }
+		var sq = [1, 2, 3].map(x => x * x);
+		console.log(n + ' ' + sq.join(',') + ' ' + strict());
+	`)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if out != "350 1,4,9 true" {
+		t.Errorf("Run = %q, want %q", out, "350 1,4,9 true")
+	}
+}
+
+func TestGojaEngine_Globals(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{
+		RemovedGlobals: []string{"eval", "navigator"},
+		FrozenGlobals:  []string{"Math"},
+	})
+	out, err := e.Run(`Math.random = function() { return 1; }; console.log(typeof eval + ' ' + typeof navigator + ' ' + (Math.random() !== 1));`)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if out != "undefined undefined true" {
+		t.Errorf("Run = %q, want %q", out, "undefined undefined true")
+	}
+}
+
+func TestGojaEngine_PoolReusesCleanRuntimes(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{PoolSize: 1})
+
+	if _, err := e.Run(`var leaked = 'secret'; document.getElementById('x').value = 'dirty';`); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	out, err := e.Run(`console.log(typeof leaked === 'undefined' || leaked === undefined ? document.getElementById('x').value : leaked)`)
+	if err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	if out != "" {
+		t.Errorf("state leaked between pooled runs: %q", out)
+	}
+
+	stats := e.PoolStats()
+	if stats.Created != 1 || stats.Reused != 1 || stats.Idle != 1 {
+		t.Errorf("PoolStats = %+v, want 1 created, 1 reused, 1 idle", stats)
+	}
+}
+
+func TestGojaEngine_PoolRestoresBuiltins(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{PoolSize: 1})
+
+	// A replaced console is reinstalled, and the runtime is still reused.
+	if _, err := e.Run(`console.log = function() {};`); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	out, err := e.Run(`console.log('clean')`)
+	if err != nil || out != "clean" {
+		t.Fatalf("Run after replacing console.log = %q, %v; want %q", out, err, "clean")
+	}
+	if stats := e.PoolStats(); stats.Reused != 1 || stats.Discarded != 0 {
+		t.Errorf("PoolStats = %+v, want the runtime reused", stats)
+	}
+
+	// A changed built-in cannot be undone, so the runtime is discarded.
+	if _, err := e.Run(`console.log = function() {}; Math.random = function() { return 2; }; Array.prototype.evil = 1;`); err != nil {
+		t.Fatalf("polluting Run: %v", err)
+	}
+	out, err = e.Run(`console.log(String(Math.random() < 1) + ' ' + [].evil)`)
+	if err != nil {
+		t.Fatalf("Run after pollution: %v", err)
+	}
+	if out != "true undefined" {
+		t.Errorf("Run after pollution = %q, want %q", out, "true undefined")
+	}
+	if stats := e.PoolStats(); stats.Created != 2 || stats.Discarded != 1 {
+		t.Errorf("PoolStats = %+v, want the polluted runtime discarded", stats)
+	}
+}
+
+func TestGojaEngine_PoolKeepsGlobalsHardened(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{
+		PoolSize:       1,
+		RemovedGlobals: []string{"setTimeout", "navigator"},
+		FrozenGlobals:  []string{"document"},
+	})
+	script := `
+		document.cookie = 'changed';
+		console.log(typeof setTimeout + ' ' + typeof navigator + ' ' + document.cookie);
+	`
+	for i := 0; i < 3; i++ {
+		out, err := e.Run(script)
+		if err != nil {
+			t.Fatalf("Run %d: %v", i+1, err)
+		}
+		if out != "undefined undefined " {
+			t.Errorf("Run %d = %q, want %q", i+1, out, "undefined undefined ")
+		}
+	}
+	if stats := e.PoolStats(); stats.Reused != 2 {
+		t.Errorf("PoolStats = %+v, want the runtime reused", stats)
+	}
+}
+
+func TestGojaEngine_PoolDiscardsInterruptedRuntimes(t *testing.T) {
+	e := NewGojaEngine(GojaOptions{PoolSize: 1, Timeout: 20 * time.Millisecond})
+	if _, err := e.Run(`for (;;) {}`); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if stats := e.PoolStats(); stats.Discarded != 1 || stats.Idle != 0 {
+		t.Errorf("PoolStats = %+v, want the interrupted runtime discarded", stats)
+	}
+	if _, err := e.Run(`console.log('ok')`); err != nil {
+		t.Errorf("Run after discard: %v", err)
+	}
+}
+
+func TestGojaEngine_ExecuteDiagnostics(t *testing.T) {
+	res, err := NewGojaEngine().Execute(`
+		console.warn('careful', 1);
+		console.log(navigator.userAgent === '' ? 'empty' : 'set');
+		function boom() { throw new Error('kaboom'); }
+		boom();
+	`)
+	if err == nil {
+		t.Fatal("expected the thrown exception to fail the execution")
+	}
+	if res == nil {
+		t.Fatal("expected a partial result alongside the error")
+	}
+
+	if len(res.Console) != 2 || res.Console[0].Level != LevelWarn || res.Console[0].Text() != "careful 1" {
+		t.Errorf("Console = %+v", res.Console)
+	}
+	if res.Value != "empty" {
+		t.Errorf("Value = %q, want %q", res.Value, "empty")
+	}
+	if len(res.Exceptions) != 1 {
+		t.Fatalf("Exceptions = %+v, want 1", res.Exceptions)
+	}
+	if ex := res.Exceptions[0]; ex.Message != "Error: kaboom" || !strings.Contains(ex.Stack, "boom") {
+		t.Errorf("Exception = %+v", ex)
+	}
+	if len(res.ShimAccess) != 1 || res.ShimAccess[0] != "navigator.userAgent" {
+		t.Errorf("ShimAccess = %v", res.ShimAccess)
+	}
+}
+
+func TestGojaEngine_SolveV2RunsTimersVirtually(t *testing.T) {
+	scripts := [][]string{{"", `
+		var order = [];
+		setTimeout(function() {
+			order.push('late');
+			document.getElementById('jschl-answer').value = order.join(',');
+		}, 4000);
+		var id = setTimeout(function() { order.push('cleared'); }, 10);
+		setTimeout(function(a) { order.push(a); }, 100, 'early');
+		clearTimeout(id);
+	`}}
+
+	start := time.Now()
+	res, err := NewGojaEngine().SolveV2("", "example.com", scripts, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("SolveV2: %v", err)
+	}
+	if res.Value != "early,late" {
+		t.Errorf("answer = %q, want %q", res.Value, "early,late")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SolveV2 took %v, timers should not sleep", elapsed)
+	}
+}
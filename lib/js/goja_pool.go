@@ -0,0 +1,398 @@
+package js
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync/atomic"
+
+	"github.com/dop251/goja"
+)
+
+// The DOM shim and the helpers used to prepare and recycle runtimes are compiled
+// once per process; installing them in a runtime only executes the bytecode.
+var (
+	setupProgram         = goja.MustCompile("setup.js", setupScript, false)
+	freezeGlobalsProgram = goja.MustCompile("freeze.js", freezeGlobalsScript, false)
+	resetGlobalsProgram  = goja.MustCompile("reset.js", resetGlobalsScript, false)
+	trackShimProgram     = goja.MustCompile("track.js", trackShimScript, false)
+	timersProgram        = goja.MustCompile("timers.js", timerShimScript, false)
+	builtinsProgram      = goja.MustCompile("builtins.js", builtinsScript, false)
+)
+
+// resetGlobalsScript removes every global that was not present when the runtime
+// was initialised. Globals declared with `var` cannot be deleted, so they are
+// overwritten with undefined instead.
+const resetGlobalsScript = `(function(baseline) {
+	var names = Object.getOwnPropertyNames(globalThis);
+	for (var i = 0; i < names.length; i++) {
+		var name = names[i];
+		if (baseline.indexOf(name) >= 0) continue;
+		if (!delete globalThis[name]) {
+			try { globalThis[name] = undefined; } catch (e) {}
+		}
+	}
+})`
+
+// builtinsScript snapshots the named built-in globals, the own properties of
+// their values and of the values' prototype objects, and returns a function
+// reporting whether any of them is still the same. The helpers it needs are
+// captured up front, so that a script replacing them cannot hide its changes.
+const builtinsScript = `(function(names) {
+	var ownKeys = Reflect.ownKeys, describe = Object.getOwnPropertyDescriptor,
+		protoOf = Object.getPrototypeOf, isExtensible = Object.isExtensible, is = Object.is;
+	function isObject(v) {
+		return v !== null && (typeof v === 'object' || typeof v === 'function');
+	}
+	function same(a, b) {
+		if (a === undefined || b === undefined) return a === b;
+		return is(a.value, b.value) && a.get === b.get && a.set === b.set &&
+			a.writable === b.writable && a.enumerable === b.enumerable && a.configurable === b.configurable;
+	}
+	var globals = [], objects = [], protos = [], extensible = [], keys = [], props = [];
+	function add(o) {
+		// The global object itself is handled by the reset.
+		if (!isObject(o) || o === globalThis) return;
+		for (var i = 0; i < objects.length; i++) if (objects[i] === o) return;
+		var n = objects.length, k = ownKeys(o), d = [];
+		for (var j = 0; j < k.length; j++) d[j] = describe(o, k[j]);
+		objects[n] = o;
+		protos[n] = protoOf(o);
+		extensible[n] = isExtensible(o);
+		keys[n] = k;
+		props[n] = d;
+	}
+	for (var i = 0; i < names.length; i++) {
+		var d = describe(globalThis, names[i]);
+		globals[i] = d;
+		if (!d || !isObject(d.value)) continue;
+		add(d.value);
+		var proto = describe(d.value, 'prototype');
+		if (proto) add(proto.value);
+	}
+	add(protoOf(globalThis));
+
+	return function() {
+		for (var i = 0; i < names.length; i++) {
+			if (!same(describe(globalThis, names[i]), globals[i])) return false;
+		}
+		for (var i = 0; i < objects.length; i++) {
+			var o = objects[i], was = keys[i], now = ownKeys(o), d = props[i];
+			if (protoOf(o) !== protos[i] || isExtensible(o) !== extensible[i] || now.length !== was.length) return false;
+			for (var j = 0; j < was.length; j++) {
+				if (now[j] !== was[j] || !same(describe(o, was[j]), d[j])) return false;
+			}
+		}
+		return true;
+	};
+})`
+
+// errBuiltinsChanged is returned by reset for runtimes whose built-ins were
+// modified by the previous execution.
+var errBuiltinsChanged = errors.New("goja: script modified built-in objects")
+
+// PoolStats reports how the runtime pool of a GojaEngine is being used.
+type PoolStats struct {
+	// Size is the maximum number of idle runtimes kept for reuse.
+	Size int
+	// Idle is the number of runtimes currently waiting in the pool.
+	Idle int
+	// Created counts runtimes built from scratch.
+	Created uint64
+	// Reused counts executions served by a recycled runtime.
+	Reused uint64
+	// Discarded counts runtimes dropped because they were interrupted, modified
+	// built-in objects, or the pool was full.
+	Discarded uint64
+}
+
+// gojaVM is a pre-initialised runtime: console capture and the DOM shim are installed
+// and the configured globals are hardened.
+type gojaVM struct {
+	rt *goja.Runtime
+	// diag collects console output for the current execution.
+	diag *Result
+	// block is the index of the script block currently executing.
+	block int
+	// lastLog is the first argument of the most recent console.log call.
+	lastLog string
+	// access collects the shim properties read during the current execution.
+	access accessSet
+	// baseline lists the global names present after initialisation.
+	baseline goja.Value
+	// builtinsIntact reports whether the built-in objects are unchanged since
+	// initialisation.
+	builtinsIntact goja.Callable
+	// tainted marks a runtime that was interrupted mid-execution and must not be reused.
+	tainted bool
+	// clock is the virtual clock of the current execution in deterministic mode.
+	clock *virtualClock
+	// steps counts the loop iterations and function calls of the current
+	// execution against MaxIterations.
+	steps int
+}
+
+// gojaPool keeps idle runtimes for reuse across executions.
+type gojaPool struct {
+	idle      chan *gojaVM
+	created   atomic.Uint64
+	reused    atomic.Uint64
+	discarded atomic.Uint64
+}
+
+// newGojaPool creates a pool keeping up to size idle runtimes.
+// A negative size disables pooling; zero selects GOMAXPROCS.
+func newGojaPool(size int) *gojaPool {
+	if size == 0 {
+		size = runtime.GOMAXPROCS(0)
+	}
+	if size < 0 {
+		size = 0
+	}
+	return &gojaPool{idle: make(chan *gojaVM, size)}
+}
+
+// acquire returns an idle runtime from the pool, or initialises a new one.
+func (e *GojaEngine) acquire() (*gojaVM, error) {
+	if e.pool == nil {
+		// A zero GojaEngine literal has no pool and initialises a runtime per call.
+		vm, err := e.initVM()
+		if err != nil {
+			return nil, err
+		}
+		e.prepare(vm)
+		return vm, nil
+	}
+	select {
+	case vm := <-e.pool.idle:
+		e.pool.reused.Add(1)
+		e.prepare(vm)
+		return vm, nil
+	default:
+	}
+
+	vm, err := e.initVM()
+	if err != nil {
+		return nil, err
+	}
+	e.pool.created.Add(1)
+	e.prepare(vm)
+	return vm, nil
+}
+
+// prepare resets the per-execution state of vm and reinstalls the console,
+// which challenge scripts commonly replace. In deterministic mode every
+// execution starts from the same seed and the same virtual instant.
+func (e *GojaEngine) prepare(vm *gojaVM) {
+	vm.diag = &Result{}
+	vm.block = 0
+	vm.lastLog = ""
+	vm.access = accessSet{}
+	vm.steps = 0
+	// A removed console stays removed, and a frozen one cannot have changed.
+	if !slices.Contains(e.opts.RemovedGlobals, "console") && !slices.Contains(e.opts.FrozenGlobals, "console") {
+		vm.installConsole()
+	}
+
+	d := e.opts.Deterministic
+	if d == nil {
+		return
+	}
+	vm.clock = &virtualClock{start: d.start(), tick: d.Tick}
+	vm.rt.SetTimeSource(vm.clock.Now)
+	vm.rt.SetRandSource((&mulberry32{state: uint32(d.Seed)}).Float64)
+}
+
+// recordConsole appends a console call to the diagnostics of the current execution.
+func (vm *gojaVM) recordConsole(level string, call goja.FunctionCall) {
+	if vm.diag == nil {
+		return
+	}
+	args := make([]string, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = arg.String()
+	}
+	vm.diag.Console = append(vm.diag.Console, ConsoleMessage{Level: level, Args: args, Block: vm.block})
+	if level == LevelLog && len(args) > 0 {
+		vm.lastLog = args[0]
+	}
+}
+
+// installConsole defines a console whose calls are recorded in the diagnostics
+// of the current execution.
+func (vm *gojaVM) installConsole() {
+	console := vm.rt.NewObject()
+	for _, level := range consoleLevels {
+		level := level
+		console.Set(level, func(call goja.FunctionCall) goja.Value {
+			vm.recordConsole(level, call)
+			return goja.Undefined()
+		})
+	}
+	vm.rt.Set("console", console)
+}
+
+// trackShim wraps the DOM shim objects so that property reads are recorded.
+func (vm *gojaVM) trackShim() error {
+	fn, err := vm.rt.RunProgram(trackShimProgram)
+	if err != nil {
+		return err
+	}
+	track, ok := goja.AssertFunction(fn)
+	if !ok {
+		return fmt.Errorf("goja: shim tracker is not a function")
+	}
+	record := func(name string) {
+		if vm.access != nil {
+			vm.access[name] = struct{}{}
+		}
+	}
+	_, err = track(goja.Undefined(), vm.rt.ToValue(record))
+	return err
+}
+
+// installPerformance defines a performance.now that reads the virtual clock.
+// It is only installed in deterministic mode; goja has no performance object otherwise.
+func (e *GojaEngine) installPerformance(vm *gojaVM) {
+	if e.opts.Deterministic == nil {
+		return
+	}
+	performance := vm.rt.NewObject()
+	performance.Set("now", func(goja.FunctionCall) goja.Value {
+		return vm.rt.ToValue(vm.clock.elapsed())
+	})
+	vm.rt.Set("performance", performance)
+}
+
+// release resets vm and returns it to the pool. Runtimes that were interrupted,
+// fail to reset, or do not fit in the pool are discarded.
+func (e *GojaEngine) release(vm *gojaVM) {
+	vm.diag, vm.access = nil, nil
+	if e.pool == nil {
+		return
+	}
+	if vm.tainted || e.reset(vm) != nil {
+		e.pool.discarded.Add(1)
+		return
+	}
+	select {
+	case e.pool.idle <- vm:
+	default:
+		e.pool.discarded.Add(1)
+	}
+}
+
+// initVM builds a runtime and installs the console capture and the DOM shim.
+func (e *GojaEngine) initVM() (*gojaVM, error) {
+	rt := goja.New()
+	if e.opts.MaxCallStackSize > 0 {
+		rt.SetMaxCallStackSize(e.opts.MaxCallStackSize)
+	}
+	vm := &gojaVM{rt: rt}
+
+	// The built-ins are the globals goja defines before anything is installed.
+	builtins, err := rt.RunString(`Object.getOwnPropertyNames(globalThis)`)
+	if err != nil {
+		return nil, fmt.Errorf("goja: failed to list built-ins: %w", err)
+	}
+
+	// Setup safe console capturing
+	vm.installConsole()
+
+	// Security: Running setup script in VM.
+	if _, err := rt.RunProgram(setupProgram); err != nil {
+		return nil, fmt.Errorf("goja: failed to set up DOM shim: %w", err)
+	}
+	if _, err := rt.RunProgram(timersProgram); err != nil {
+		return nil, fmt.Errorf("goja: failed to set up timers: %w", err)
+	}
+	if err := vm.trackShim(); err != nil {
+		return nil, fmt.Errorf("goja: failed to instrument DOM shim: %w", err)
+	}
+	e.installPerformance(vm)
+	if err := e.installStep(vm); err != nil {
+		return nil, fmt.Errorf("goja: failed to install the iteration counter: %w", err)
+	}
+	if err := e.harden(rt); err != nil {
+		return nil, err
+	}
+
+	names, err := rt.RunString(`Object.getOwnPropertyNames(globalThis)`)
+	if err != nil {
+		return nil, fmt.Errorf("goja: failed to snapshot globals: %w", err)
+	}
+	vm.baseline = names
+
+	// Snapshot the built-ins once hardened, so that pooled runtimes whose
+	// built-ins were changed by a script can be told apart.
+	fn, err := rt.RunProgram(builtinsProgram)
+	if err != nil {
+		return nil, fmt.Errorf("goja: failed to snapshot built-ins: %w", err)
+	}
+	snapshot, _ := goja.AssertFunction(fn)
+	check, err := snapshot(goja.Undefined(), builtins)
+	if err != nil {
+		return nil, fmt.Errorf("goja: failed to snapshot built-ins: %w", err)
+	}
+	vm.builtinsIntact, _ = goja.AssertFunction(check)
+	return vm, nil
+}
+
+// reset removes the globals left behind by the previous execution, reinstalls
+// the DOM shim so that the next execution starts from a clean document, and
+// hardens the runtime again. It fails with errBuiltinsChanged if the previous
+// script changed a built-in object, such as Math.random or Array.prototype,
+// which cannot be undone.
+//
+// The previous script may have replaced built-ins, so the reset is guarded like
+// any other execution.
+func (e *GojaEngine) reset(vm *gojaVM) error {
+	return e.guard(vm, func() error {
+		intact, err := vm.builtinsIntact(goja.Undefined())
+		if err != nil {
+			return err
+		}
+		if !intact.ToBoolean() {
+			return errBuiltinsChanged
+		}
+		fn, err := vm.rt.RunProgram(resetGlobalsProgram)
+		if err != nil {
+			return err
+		}
+		resetGlobals, ok := goja.AssertFunction(fn)
+		if !ok {
+			return fmt.Errorf("goja: reset helper is not a function")
+		}
+		if _, err := resetGlobals(goja.Undefined(), vm.baseline); err != nil {
+			return err
+		}
+		if _, err := vm.rt.RunProgram(setupProgram); err != nil {
+			return err
+		}
+		if _, err := vm.rt.RunProgram(timersProgram); err != nil {
+			return err
+		}
+		if err := vm.trackShim(); err != nil {
+			return err
+		}
+		e.installPerformance(vm)
+		// The shim and timers are installed afresh, so the sandbox settings
+		// must be applied to them again.
+		return e.harden(vm.rt)
+	})
+}
+
+// PoolStats returns a snapshot of the runtime pool counters.
+func (e *GojaEngine) PoolStats() PoolStats {
+	if e.pool == nil {
+		return PoolStats{}
+	}
+	return PoolStats{
+		Size:      cap(e.pool.idle),
+		Idle:      len(e.pool.idle),
+		Created:   e.pool.created.Load(),
+		Reused:    e.pool.reused.Load(),
+		Discarded: e.pool.discarded.Load(),
+	}
+}
@@ -0,0 +1,186 @@
+package js
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+// errIterationBudget is the interrupt value used when MaxIterations is exceeded.
+var errIterationBudget = errors.New("iteration budget exceeded")
+
+// stepFunc is the global through which instrumented scripts count their
+// iterations. Its name is random so that a script cannot shadow it.
+var stepFunc = "__step_" + randomSuffix()
+
+func randomSuffix() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// installStep defines the step counter of vm. The binding is read-only and
+// cannot be deleted, so scripts cannot disable it.
+func (e *GojaEngine) installStep(vm *gojaVM) error {
+	if e.opts.MaxIterations <= 0 {
+		return nil
+	}
+	step := vm.rt.ToValue(func(goja.FunctionCall) goja.Value {
+		vm.steps++
+		if vm.steps > e.opts.MaxIterations {
+			vm.rt.Interrupt(errIterationBudget)
+		}
+		return goja.Undefined()
+	})
+	return vm.rt.GlobalObject().DefineDataProperty(stepFunc, step, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+}
+
+// instrument counts the loop iterations and function calls of script against
+// MaxIterations, by inserting a call to the step counter at the start of every
+// loop body and function body. Scripts that do not parse are returned as is,
+// so that running them reports the syntax error.
+func (e *GojaEngine) instrument(script string) string {
+	if e.opts.MaxIterations <= 0 {
+		return script
+	}
+	prog, err := parser.ParseFile(nil, "", script, 0)
+	if err != nil {
+		return script
+	}
+
+	type insertion struct {
+		at    int
+		text  string
+		close bool
+	}
+	var ins []insertion
+	call := stepFunc + "();"
+	// Node positions are 1-based byte offsets into script. end returns the
+	// offset after the node ending at idx, including its semicolon.
+	end := func(idx int) int {
+		at := idx - 1
+		for at < len(script) && (script[at] == ' ' || script[at] == '\t') {
+			at++
+		}
+		if at < len(script) && script[at] == ';' {
+			return at + 1
+		}
+		return idx - 1
+	}
+	// function counts the call after the directive prologue of body, so that
+	// "use strict" keeps its meaning.
+	function := func(body *ast.BlockStatement) {
+		at := int(body.LeftBrace)
+		for _, stmt := range body.List {
+			es, ok := stmt.(*ast.ExpressionStatement)
+			if !ok {
+				break
+			}
+			if _, ok := es.Expression.(*ast.StringLiteral); !ok {
+				break
+			}
+			at = end(int(es.Idx1()))
+		}
+		ins = append(ins, insertion{at: at, text: call})
+	}
+	loop := func(body ast.Statement) {
+		if b, ok := body.(*ast.BlockStatement); ok {
+			ins = append(ins, insertion{at: int(b.LeftBrace), text: call})
+			return
+		}
+		// The braces take the statement's semicolon, so that a do-while body
+		// is still followed by its while.
+		ins = append(ins,
+			insertion{at: int(body.Idx0()) - 1, text: "{" + call},
+			insertion{at: end(int(body.Idx1())), text: "}", close: true})
+	}
+
+	walkAST(reflect.ValueOf(prog), func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.ForStatement:
+			loop(n.Body)
+		case *ast.ForInStatement:
+			loop(n.Body)
+		case *ast.ForOfStatement:
+			loop(n.Body)
+		case *ast.WhileStatement:
+			loop(n.Body)
+		case *ast.DoWhileStatement:
+			loop(n.Body)
+		case *ast.FunctionLiteral:
+			if n.Body != nil {
+				function(n.Body)
+			}
+		case *ast.ArrowFunctionLiteral:
+			switch body := n.Body.(type) {
+			case *ast.BlockStatement:
+				function(body)
+			case *ast.ExpressionBody:
+				ins = append(ins,
+					insertion{at: int(body.Expression.Idx0()) - 1, text: "(" + stepFunc + "(),"},
+					insertion{at: int(body.Expression.Idx1()) - 1, text: ")", close: true})
+			}
+		}
+	})
+	if len(ins) == 0 {
+		return script
+	}
+
+	// At the same offset, inner constructs are closed before the next one is
+	// opened, and outer ones, visited first, are opened first.
+	sort.SliceStable(ins, func(i, j int) bool {
+		if ins[i].at != ins[j].at {
+			return ins[i].at < ins[j].at
+		}
+		return ins[i].close && !ins[j].close
+	})
+	var b strings.Builder
+	b.Grow(len(script) + len(ins)*len(call))
+	last := 0
+	for _, in := range ins {
+		b.WriteString(script[last:in.at])
+		b.WriteString(in.text)
+		last = in.at
+	}
+	b.WriteString(script[last:])
+	return b.String()
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// walkAST calls visit for every node reachable from v.
+func walkAST(v reflect.Value, visit func(ast.Node)) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkAST(v.Elem(), visit)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if v.Type().Implements(nodeType) {
+			visit(v.Interface().(ast.Node))
+		}
+		walkAST(v.Elem(), visit)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				walkAST(v.Field(i), visit)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkAST(v.Index(i), visit)
+		}
+	}
+}
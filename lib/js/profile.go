@@ -0,0 +1,119 @@
+package js
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ModuleMode selects how an external runtime interprets the script piped to it.
+type ModuleMode string
+
+const (
+	// ModuleDefault leaves the choice to the runtime's own default.
+	ModuleDefault ModuleMode = ""
+	// CommonJS runs the script as a CommonJS script (`require` is available).
+	CommonJS ModuleMode = "commonjs"
+	// ESM runs the script as an ECMAScript module.
+	ESM ModuleMode = "module"
+)
+
+// Profile describes how a specific external runtime must be invoked so that it
+// executes a script read from stdin instead of starting a REPL.
+type Profile struct {
+	Runtime Runtime
+	// Args are the arguments that make the runtime read the script from stdin.
+	Args []string
+	// ModuleArgs holds the extra arguments, placed before Args, for each supported
+	// module mode. A mode missing from the map is not supported by the runtime.
+	ModuleArgs map[ModuleMode][]string
+	// MinVersion is the oldest release known to support Args, e.g. "1.0.0".
+	MinVersion string
+}
+
+var profiles = map[Runtime]Profile{
+	Node: {
+		Runtime: Node,
+		Args:    []string{"-"},
+		ModuleArgs: map[ModuleMode][]string{
+			ModuleDefault: nil,
+			CommonJS:      {"--input-type=commonjs"},
+			ESM:           {"--input-type=module"},
+		},
+		// --input-type was unflagged in 12.17 / 13.2; 14 is the first LTS with both.
+		MinVersion: "14.0.0",
+	},
+	Deno: {
+		Runtime: Deno,
+		// A bare `deno` starts a REPL; `deno run -` executes stdin.
+		Args: []string{"run", "--quiet", "-"},
+		ModuleArgs: map[ModuleMode][]string{
+			// Deno only understands ES modules.
+			ModuleDefault: nil,
+			ESM:           nil,
+		},
+		MinVersion: "1.0.0",
+	},
+	Bun: {
+		Runtime: Bun,
+		// Reading from stdin via `bun run -` is only available from 1.0 onwards.
+		Args: []string{"run", "-"},
+		ModuleArgs: map[ModuleMode][]string{
+			// Bun detects the module format on its own and accepts both.
+			ModuleDefault: nil,
+			CommonJS:      nil,
+			ESM:           nil,
+		},
+		MinVersion: "1.0.0",
+	},
+}
+
+// ProfileFor returns the invocation profile of an external runtime.
+func ProfileFor(runtime Runtime) (Profile, bool) {
+	p, ok := profiles[runtime]
+	return p, ok
+}
+
+// Command returns the arguments used to run a script in the given module mode.
+func (p Profile) Command(mode ModuleMode) ([]string, error) {
+	extra, ok := p.ModuleArgs[mode]
+	if !ok {
+		return nil, fmt.Errorf("javascript runtime '%s' does not support module mode '%s'", p.Runtime, mode)
+	}
+	args := make([]string, 0, len(extra)+len(p.Args))
+	args = append(args, extra...)
+	return append(args, p.Args...), nil
+}
+
+var versionRegex = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseVersion extracts the first "major.minor[.patch]" triple from the output
+// of `<runtime> --version`, e.g. "v20.11.1" or "deno 1.40.2 (release, ...)".
+func parseVersion(s string) ([3]int, bool) {
+	var v [3]int
+	m := versionRegex.FindStringSubmatch(s)
+	if m == nil {
+		return v, false
+	}
+	for i := 0; i < 3; i++ {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// versionAtLeast reports whether version is greater than or equal to min.
+func versionAtLeast(version, min [3]int) bool {
+	for i := 0; i < 3; i++ {
+		if version[i] != min[i] {
+			return version[i] > min[i]
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package js
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [3]int
+	}{
+		{"v20.11.1", [3]int{20, 11, 1}},
+		{"deno 1.40.2 (release, x86_64-unknown-linux-gnu)", [3]int{1, 40, 2}},
+		{"1.1.8", [3]int{1, 1, 8}},
+		{"v21.0", [3]int{21, 0, 0}},
+	}
+	for _, tt := range tests {
+		got, ok := parseVersion(tt.in)
+		if !ok || got != tt.want {
+			t.Errorf("parseVersion(%q) = %v, %v; want %v", tt.in, got, ok, tt.want)
+		}
+	}
+	if _, ok := parseVersion("unknown"); ok {
+		t.Errorf("parseVersion(%q) succeeded, want failure", "unknown")
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	if !versionAtLeast([3]int{14, 0, 0}, [3]int{14, 0, 0}) {
+		t.Error("equal versions should satisfy the minimum")
+	}
+	if !versionAtLeast([3]int{20, 1, 0}, [3]int{14, 0, 0}) {
+		t.Error("newer major should satisfy the minimum")
+	}
+	if versionAtLeast([3]int{0, 9, 9}, [3]int{1, 0, 0}) {
+		t.Error("older version should not satisfy the minimum")
+	}
+}
+
+func TestProfileCommand(t *testing.T) {
+	deno, _ := ProfileFor(Deno)
+	if _, err := deno.Command(CommonJS); err == nil {
+		t.Error("deno should reject CommonJS mode")
+	}
+	node, _ := ProfileFor(Node)
+	args, err := node.Command(ESM)
+	if err != nil {
+		t.Fatalf("node ESM: %v", err)
+	}
+	if len(args) != 2 || args[0] != "--input-type=module" || args[1] != "-" {
+		t.Errorf("node ESM args = %v", args)
+	}
+}
+
+func TestNewExternalEngine_RejectsForeignBinary(t *testing.T) {
+	if _, err := NewExternalEngine("node", ExternalOptions{Path: "/bin/sh"}); err == nil {
+		t.Error("expected an explicit path to a non-node binary to be rejected")
+	}
+	if _, err := NewExternalEngine("python"); err == nil {
+		t.Error("expected an unknown runtime to be rejected")
+	}
+}
@@ -2,7 +2,9 @@ var window = this;
 var navigator = { userAgent: "" };
 var document = {
     getElementById: function(id) {
-        return { value: "" };
+        if (!this.elements) this.elements = {};
+        if (!this.elements[id]) this.elements[id] = { value: "" };
+        return this.elements[id];
     },
     createElement: function(tag) {
         return {
@@ -0,0 +1,55 @@
+package js
+
+import "strconv"
+
+// MaxTimerRuns bounds the number of timer callbacks run when the timer queue is
+// drained, so that a setInterval that is never cleared cannot spin forever.
+const MaxTimerRuns = 1000
+
+// timerShimScript replaces setTimeout and setInterval with a virtual timer queue.
+// Callbacks never fire on their own: __drainTimers runs them in the order a
+// browser would, advancing a virtual clock instead of sleeping, and returns the
+// virtual time in milliseconds at which the last callback ran.
+const timerShimScript = `(function(g) {
+	var queue = [], seq = 0, now = 0;
+	function schedule(fn, delay, args, repeat) {
+		delay = Math.max(0, +delay || 0);
+		var id = ++seq;
+		queue.push({id: id, fn: fn, at: now + delay, args: args, every: repeat ? Math.max(1, delay) : 0});
+		return id;
+	}
+	function clear(id) {
+		queue = queue.filter(function(t) { return t.id !== id; });
+	}
+	g.setTimeout = function(fn, delay) {
+		return schedule(fn, delay, Array.prototype.slice.call(arguments, 2), false);
+	};
+	g.setInterval = function(fn, delay) {
+		return schedule(fn, delay, Array.prototype.slice.call(arguments, 2), true);
+	};
+	g.clearTimeout = clear;
+	g.clearInterval = clear;
+	g.__drainTimers = function(limit) {
+		for (var n = 0; queue.length > 0 && n < limit; n++) {
+			queue.sort(function(a, b) { return a.at - b.at || a.id - b.id; });
+			var t = queue.shift();
+			now = t.at;
+			if (t.every) queue.push({id: t.id, fn: t.fn, at: now + t.every, args: t.args, every: t.every});
+			try {
+				if (typeof t.fn === 'function') t.fn.apply(g, t.args);
+				else (0, eval)(String(t.fn));
+			} catch (e) {
+				if (g.console && g.console.error) g.console.error(String(e));
+			}
+		}
+		return now;
+	};
+})(globalThis);`
+
+// VirtualTimers wraps script so that its timers run on a virtual clock: the
+// timer shim is installed first and the queue is drained once the script has
+// run. The returned script finishes without waiting for any timeout, which lets
+// the caller decide how long to actually wait.
+func VirtualTimers(script string) string {
+	return timerShimScript + "\n" + script + ";\n__drainTimers(" + strconv.Itoa(MaxTimerRuns) + ");\n"
+}
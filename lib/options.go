@@ -26,10 +26,25 @@ type Options struct {
 		Strategy proxy.Strategy
 		BanTime  time.Duration
 	}
-	Stealth       stealth.Options
-	JSRuntime     js.Runtime // "goja", "node", "deno", "bun"
-	CustomJSEngine js.Engine  // Custom JS engine implementation (overrides JSRuntime if set)
-	Logger        *log.Logger
+	Stealth         stealth.Options
+	JSRuntime       js.Runtime         // "goja", "node", "deno", "bun"
+	ExternalJS      js.ExternalOptions // Invocation options for the node, deno and bun runtimes
+	Goja            js.GojaOptions     // Sandbox limits for the built-in goja runtime
+	DeterministicJS *js.Deterministic  // Seeded Math.random and virtual clock for reproducible solves
+	CustomJSEngine  js.Engine          // Custom JS engine implementation (overrides JSRuntime if set)
+	Logger          *log.Logger
+	// ChallengeDelay is how long to wait after a JS challenge page is received
+	// before submitting the answer. ServerChallengeDelay, the default, uses the
+	// delay the page's script asks for.
+	ChallengeDelay time.Duration
+	// MaxChallengeAttempts bounds the challenges attempted for a single request,
+	// including those served in response to a submitted answer.
+	MaxChallengeAttempts int
+	// Capture records every challenge page for offline debugging when set.
+	Capture *CaptureOptions
+	// ChallengeHandlers are consulted before the built-in handlers. A handler
+	// named like a built-in one replaces it.
+	ChallengeHandlers []ChallengeHandler
 }
 
 // ScraperOption configures a Scraper.
@@ -74,6 +89,32 @@ func WithSessionConfig(refreshOn403 bool, interval time.Duration, maxRetries int
 	}
 }
 
+// WithChallengeDelay overrides the delay before a JS challenge answer is
+// submitted. Zero submits immediately, which is useful against local test
+// servers; ServerChallengeDelay restores the default.
+func WithChallengeDelay(d time.Duration) ScraperOption {
+	return func(o *Options) {
+		o.ChallengeDelay = d
+	}
+}
+
+// WithMaxChallengeAttempts sets how many challenges are attempted for a single
+// request before it fails with errors.ErrChallengeLoop.
+func WithMaxChallengeAttempts(n int) ScraperOption {
+	return func(o *Options) {
+		o.MaxChallengeAttempts = n
+	}
+}
+
+// WithChallengeCapture records every challenge page encountered, with the
+// answer, the submitted form and the response that followed, to a directory
+// and/or a callback. Cookie values are redacted unless opts.KeepCookies is set.
+func WithChallengeCapture(opts CaptureOptions) ScraperOption {
+	return func(o *Options) {
+		o.Capture = &opts
+	}
+}
+
 // WithDelay sets a fixed delay between requests (used by StealthMode if HumanLikeDelays is false).
 func WithDelay(d time.Duration) ScraperOption {
 	return func(o *Options) {
@@ -90,6 +131,32 @@ func WithJSRuntime(runtime js.Runtime) ScraperOption {
 	}
 }
 
+// WithExternalJSOptions configures how an external runtime (js.Node, js.Deno, js.Bun)
+// is located and invoked, e.g. an explicit binary path instead of a PATH lookup.
+// It has no effect unless an external runtime is selected with WithJSRuntime.
+func WithExternalJSOptions(opts js.ExternalOptions) ScraperOption {
+	return func(o *Options) {
+		o.ExternalJS = opts
+	}
+}
+
+// WithGojaOptions configures the sandbox of the built-in goja runtime: execution
+// timeout, call-stack depth, iteration budget and globals to freeze or remove.
+func WithGojaOptions(opts js.GojaOptions) ScraperOption {
+	return func(o *Options) {
+		o.Goja = opts
+	}
+}
+
+// WithDeterministicJS runs challenge scripts with a seeded Math.random and a virtual
+// Date/performance clock, so that a captured challenge page produces the same answer
+// on every run. It applies to the built-in goja runtime and to external runtimes.
+func WithDeterministicJS(d js.Deterministic) ScraperOption {
+	return func(o *Options) {
+		o.DeterministicJS = &d
+	}
+}
+
 // WithCustomJSEngine sets a custom JavaScript engine implementation.
 // This overrides the JSRuntime setting and allows you to provide your own engine.
 // The engine must implement the js.Engine interface.
@@ -106,3 +173,13 @@ func WithLogger(logger *log.Logger) ScraperOption {
 		o.Logger = logger
 	}
 }
+
+// WithChallengeHandlers registers additional challenge handlers. They are tried
+// before the built-in ones, and a handler named like a built-in one (HandlerJSV2,
+// HandlerJSV1, HandlerCaptcha) replaces it. The registry can also be modified
+// after construction through Scraper.Challenges.
+func WithChallengeHandlers(handlers ...ChallengeHandler) ScraperOption {
+	return func(o *Options) {
+		o.ChallengeHandlers = append(o.ChallengeHandlers, handlers...)
+	}
+}